@@ -0,0 +1,235 @@
+package main
+
+import (
+	"backend/mailer"
+	"backend/models"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testPassword is a password of all users of test application
+const testPassword = "pa55word"
+
+// testApp type is the application serving test requests from in-memory
+// store seeded with the sample dataset, with a signed in user of every
+// role.
+type testApp struct {
+	app     *application
+	handler http.Handler
+	// Access tokens of users by their roles
+	tokens map[string]string
+	// Messages sent by application's mailer
+	mail testMailer
+}
+
+// testMailer type is a mailer passing sent messages to tests
+type testMailer chan mailer.Message
+
+// Send passes message to tests
+func (m testMailer) Send(msg mailer.Message) error {
+	m <- msg
+	return nil
+}
+
+// newTestApp function returns application of a new in-memory store, so
+// changes made by one test aren't seen by others.
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+
+	logger := log.New(io.Discard, "", 0)
+
+	var cfg config
+	cfg.env = "test"
+	cfg.store = "memory"
+	cfg.jwt.audiences = "test.local"
+	cfg.jwt.issuer = "test.local"
+	cfg.jwt.secret = "test-secret"
+	cfg.jwt.ttl = 15 * time.Minute
+	cfg.jwt.refreshTTL = time.Hour
+	cfg.jwt.leeway = time.Minute
+	cfg.trashRetention = 30 * 24 * time.Hour
+	cfg.graphql.maxDepth = 15
+	cfg.graphql.maxComplexity = 20000
+
+	keys, err := newKeyring("", "", []byte(cfg.jwt.secret), time.Time{}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mail := make(testMailer, 10)
+
+	app := &application{
+		config: cfg,
+		logger: logger,
+		models: models.NewMemoryModels(),
+		mailer: mail,
+		keys:   keys,
+	}
+
+	if app.graphql, err = app.graphqlSchema(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.seed(); err != nil {
+		t.Fatal(err)
+	}
+
+	ta := &testApp{
+		app:     app,
+		handler: app.routes(),
+		tokens:  make(map[string]string),
+		mail:    mail,
+	}
+
+	for _, role := range []string{models.RoleViewer, models.RoleEditor, models.RoleAdmin} {
+		ta.insertUser(t, role+"@test.local", role, true)
+
+		res := ta.signin(t, role+"@test.local", testPassword)
+		if res.Code != http.StatusOK {
+			t.Fatalf("signin of %s: status %d, body %s", role, res.Code, res.Body)
+		}
+
+		var tokens TokensResponse
+		decodeBody(t, res, &tokens)
+		ta.tokens[role] = tokens.Response
+	}
+
+	return ta
+}
+
+// insertUser function stores user with testPassword and returns its ID.
+func (ta *testApp) insertUser(t *testing.T, email, role string, verified bool) int {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := ta.app.models.DB.InsertUser(models.User{
+		Email:    email,
+		Password: string(hash),
+		Verified: verified,
+		Role:     role,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+// signin function signs user in and returns the response.
+func (ta *testApp) signin(t *testing.T, email, password string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	return ta.request(t, http.MethodPost, "/v1/signin", "", jsonBody(map[string]string{
+		"email":    email,
+		"password": password,
+	}), nil)
+}
+
+// mailedToken matches token in messages sent to users
+var mailedToken = regexp.MustCompile(`use this token: (\S+)`)
+
+// mailToken function waits for message sent to email and returns the token
+// it contains.
+func (ta *testApp) mailToken(t *testing.T, email string) string {
+	t.Helper()
+
+	select {
+	case msg := <-ta.mail:
+		if msg.To != email {
+			t.Fatalf("message sent to %s, expected %s", msg.To, email)
+		}
+
+		m := mailedToken.FindStringSubmatch(msg.Body)
+		if m == nil {
+			t.Fatalf("no token in message %q", msg.Body)
+		}
+
+		return m[1]
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no message sent to %s", email)
+		return ""
+	}
+}
+
+// request function serves request of user of role, anonymous one if role
+// is empty, and returns its response.
+func (ta *testApp) request(t *testing.T, method, path, role, body string, header map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if role != "" {
+		token, ok := ta.tokens[role]
+		if !ok {
+			t.Fatalf("no user of role %q", role)
+		}
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	for name, value := range header {
+		r.Header.Set(name, value)
+	}
+
+	w := httptest.NewRecorder()
+	ta.handler.ServeHTTP(w, r)
+
+	return w
+}
+
+// jsonBody function returns JSON of v as request body.
+func jsonBody(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(data)
+}
+
+// decodeBody function decodes JSON of response body into dst.
+func decodeBody(t *testing.T, res *httptest.ResponseRecorder, dst interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal(res.Body.Bytes(), dst); err != nil {
+		t.Fatalf("invalid JSON response %q: %v", res.Body, err)
+	}
+}
+
+// errorResponse type is a body of error response
+type errorResponse struct {
+	Error jsonError `json:"error"`
+}
+
+// checkResponse function checks status of response and machine-readable
+// code of error response, if code is expected.
+func checkResponse(t *testing.T, res *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+
+	if res.Code != status {
+		t.Fatalf("status %d, expected %d, body %s", res.Code, status, res.Body)
+	}
+
+	if code == "" {
+		return
+	}
+
+	var body errorResponse
+	decodeBody(t, res, &body)
+	if body.Error.Code != code {
+		t.Fatalf("error code %q, expected %q, body %s", body.Error.Code, code, res.Body)
+	}
+}
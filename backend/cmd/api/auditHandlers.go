@@ -0,0 +1,36 @@
+package main
+
+import (
+	"backend/models"
+	"net/http"
+)
+
+// auditPage is a type for paginated audit log response serialization.
+type auditPage struct {
+	Entries  []*models.AuditEntry `json:"entries"`
+	Metadata models.Metadata      `json:"metadata"`
+}
+
+// getAuditLog API handler returns one page of []models.AuditEntry objects
+// found by query string parameters (see readAuditFilter), the most recent
+// first, together with pagination metadata.
+func (app *application) getAuditLog(w http.ResponseWriter, r *http.Request) {
+	filter, err := readAuditFilter(r.URL.Query())
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	entries, meta, err := app.models.DB.AuditLog(filter)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, auditPage{Entries: entries, Metadata: meta})
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+}
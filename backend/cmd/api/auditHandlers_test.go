@@ -0,0 +1,127 @@
+package main
+
+import (
+	"backend/models"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// auditResponse type is a body of audit log response
+type auditResponse struct {
+	Entries  []models.AuditEntry `json:"entries"`
+	Metadata models.Metadata     `json:"metadata"`
+}
+
+func TestAuditLog(t *testing.T) {
+	ta := newTestApp(t)
+
+	// Entries of sample dataset are recorded before mark, the ones of API
+	// changes after it
+	mark := time.Now().UTC()
+
+	res := ta.request(t, http.MethodPatch, "/v1/movies/1", models.RoleEditor, `{"rating":2}`, map[string]string{"If-Match": `"1"`})
+	checkResponse(t, res, http.StatusOK, "")
+	res = ta.request(t, http.MethodDelete, "/v1/movies/2", models.RoleEditor, "", nil)
+	checkResponse(t, res, http.StatusNoContent, "")
+	res = ta.request(t, http.MethodPost, "/v1/admin/genres", models.RoleAdmin, `{"genre_name":"Western"}`, nil)
+	checkResponse(t, res, http.StatusCreated, "")
+
+	editor, err := ta.app.models.DB.GetUserByEmail(models.RoleEditor + "@test.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("permissions", func(t *testing.T) {
+		res := ta.request(t, http.MethodGet, "/v1/admin/audit", models.RoleEditor, "", nil)
+		checkResponse(t, res, http.StatusForbidden, "")
+
+		res = ta.request(t, http.MethodGet, "/v1/admin/audit", models.RoleAdmin, "", nil)
+		checkResponse(t, res, http.StatusOK, "")
+	})
+
+	t.Run("latest changes", func(t *testing.T) {
+		res := ta.request(t, http.MethodGet, "/v1/admin/audit?limit=3", models.RoleAdmin, "", nil)
+		checkResponse(t, res, http.StatusOK, "")
+
+		var body auditResponse
+		decodeBody(t, res, &body)
+
+		actions := []string{}
+		for _, entry := range body.Entries {
+			actions = append(actions, fmt.Sprintf("%s %s %d", entry.Action, entry.Entity, entry.EntityID))
+		}
+		expected := []string{"create genre 11", "delete movie 2", "update movie 1"}
+		if !equalStrings(actions, expected) {
+			t.Fatalf("entries %q, expected %q", actions, expected)
+		}
+
+		rating, ok := body.Entries[2].Changes["rating"]
+		if !ok || rating.Before != float64(5) || rating.After != float64(2) {
+			t.Errorf("rating change %+v, expected 5 to 2", rating)
+		}
+		if body.Entries[2].ActorID != editor.ID || body.Entries[2].RequestID == "" {
+			t.Errorf("update by actor %d in request %q, expected editor %d and a request ID",
+				body.Entries[2].ActorID, body.Entries[2].RequestID, editor.ID)
+		}
+	})
+
+	from := url.QueryEscape(mark.Format(time.RFC3339Nano))
+
+	tests := []struct {
+		name  string
+		query string
+		total int
+	}{
+		{"all", "", 23},
+		{"entity", "entity=genre", 11},
+		{"entity ID", "entity=movie&entity_id=1", 2},
+		{"actor", fmt.Sprintf("actor_id=%d", editor.ID), 2},
+		{"seed", fmt.Sprintf("actor_id=%d", models.SYSTEM_ACTOR_ID), 20},
+		{"from", "from=" + from, 3},
+		{"to", "to=" + from, 20},
+		{"page", "limit=5&offset=20", 23},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ta.request(t, http.MethodGet, "/v1/admin/audit?"+tt.query, models.RoleAdmin, "", nil)
+			checkResponse(t, res, http.StatusOK, "")
+
+			var body auditResponse
+			decodeBody(t, res, &body)
+
+			if body.Metadata.Total != tt.total {
+				t.Errorf("total %d, expected %d", body.Metadata.Total, tt.total)
+			}
+
+			entries := tt.total - body.Metadata.Offset
+			if entries > body.Metadata.Limit {
+				entries = body.Metadata.Limit
+			}
+			if len(body.Entries) != entries {
+				t.Errorf("%d entries, expected %d", len(body.Entries), entries)
+			}
+		})
+	}
+
+	invalid := []string{
+		"limit=0",
+		"limit=101",
+		"offset=-1",
+		"entity=user",
+		"entity_id=one",
+		"actor_id=one",
+		"from=yesterday",
+		"to=2024-01-01",
+	}
+
+	for _, query := range invalid {
+		t.Run(query, func(t *testing.T) {
+			res := ta.request(t, http.MethodGet, "/v1/admin/audit?"+query, models.RoleAdmin, "", nil)
+			checkResponse(t, res, http.StatusBadRequest, "")
+		})
+	}
+}
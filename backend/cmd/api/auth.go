@@ -0,0 +1,172 @@
+package main
+
+import (
+	"backend/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+// Machine-readable codes of authentication and authorization errors
+const (
+	ErrCodeMissingToken      = "missing_token"
+	ErrCodeInvalidHeader     = "invalid_auth_header"
+	ErrCodeInvalidSignature  = "invalid_signature"
+	ErrCodeMissingClaim      = "missing_claim"
+	ErrCodeInvalidClaim      = "invalid_claim"
+	ErrCodeTokenExpired      = "token_expired"
+	ErrCodeTokenNotYetValid  = "token_not_yet_valid"
+	ErrCodeInvalidAudience   = "invalid_audience"
+	ErrCodeInvalidIssuer     = "invalid_issuer"
+	ErrCodeTokenRevoked      = "token_revoked"
+	ErrCodeNotEnoughRights   = "insufficient_permissions"
+	ErrCodeAuthInternalError = "auth_internal_error"
+)
+
+// requiredClaims is the list of claims every access token must contain
+var requiredClaims = []string{"sub", "iss", "aud", "exp", "jti", "role"}
+
+// authError type describes failed authentication or authorization: 401 if
+// request is not authenticated, 403 if authenticated user is not allowed
+// to do what is requested.
+type authError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *authError) Error() string {
+	return e.message
+}
+
+// unauthorized function returns authentication error of code.
+func unauthorized(code, message string) *authError {
+	return &authError{status: http.StatusUnauthorized, code: code, message: message}
+}
+
+// authenticate function validates bearer token of request and returns user
+// and token claims. Validation pipeline: auth header format, signature,
+// required claims, expiry and not-before (with configured clock skew),
+// audience (any of configured ones), issuer, subject and role, revocation.
+func (app *application) authenticate(r *http.Request) (*models.User, *jwt.Claims, *authError) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, nil, unauthorized(ErrCodeMissingToken, "unauthorized: no token provided")
+	}
+
+	// Only permit auth header of Bearer type with 2 string parts
+	headerParts := strings.Split(authHeader, " ")
+	if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+		return nil, nil, unauthorized(ErrCodeInvalidHeader, "unauthorized: invalid auth header, Bearer token expected")
+	}
+
+	// Parsing JWT with any of known keys, picked by kid if present
+	claims, err := app.keys.check([]byte(headerParts[1]))
+	if err != nil {
+		return nil, nil, unauthorized(ErrCodeInvalidSignature, "unauthorized: failed signature check")
+	}
+
+	for _, name := range requiredClaims {
+		if !hasClaim(claims, name) {
+			return nil, nil, unauthorized(ErrCodeMissingClaim, "unauthorized: missing "+name+" claim")
+		}
+	}
+
+	now := time.Now()
+	leeway := app.config.jwt.leeway
+
+	if now.After(claims.Expires.Time().Add(leeway)) {
+		return nil, nil, unauthorized(ErrCodeTokenExpired, "unauthorized: token expired")
+	}
+
+	if claims.NotBefore != nil && now.Before(claims.NotBefore.Time().Add(-leeway)) {
+		return nil, nil, unauthorized(ErrCodeTokenNotYetValid, "unauthorized: token is not valid yet")
+	}
+
+	accepted := false
+	for _, aud := range app.config.jwtAudiences() {
+		if claims.AcceptAudience(aud) {
+			accepted = true
+			break
+		}
+	}
+	if !accepted {
+		return nil, nil, unauthorized(ErrCodeInvalidAudience, "unauthorized: invalid audience")
+	}
+
+	if claims.Issuer != app.config.jwt.issuer {
+		return nil, nil, unauthorized(ErrCodeInvalidIssuer, "unauthorized: invalid issuer")
+	}
+
+	// Subject is our user ID, note it might not match user's email
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return nil, nil, unauthorized(ErrCodeInvalidClaim, "unauthorized: invalid sub claim")
+	}
+
+	// Role is a custom claim set in Signin
+	role, _ := claims.String("role")
+	if !models.ValidRole(role) {
+		return nil, nil, unauthorized(ErrCodeInvalidClaim, "unauthorized: invalid role claim")
+	}
+
+	// Token may be revoked on signout
+	revoked, err := app.models.DB.AccessTokenRevoked(claims.ID)
+	if err != nil {
+		app.logger.Println(err)
+		return nil, nil, &authError{
+			status:  http.StatusInternalServerError,
+			code:    ErrCodeAuthInternalError,
+			message: "unable to check token revocation",
+		}
+	}
+	if revoked {
+		return nil, nil, unauthorized(ErrCodeTokenRevoked, "unauthorized: token revoked")
+	}
+
+	return &models.User{ID: userID, Role: role}, claims, nil
+}
+
+// authorize function checks that authenticated user's role grants
+// permission.
+func (app *application) authorize(user *models.User, permission string) *authError {
+	if user == nil {
+		return unauthorized(ErrCodeMissingToken, "unauthorized: no token provided")
+	}
+
+	if !models.HasPermission(user.Role, permission) {
+		return &authError{
+			status:  http.StatusForbidden,
+			code:    ErrCodeNotEnoughRights,
+			message: "forbidden: not enough permissions",
+		}
+	}
+
+	return nil
+}
+
+// authErrorJSON function writes authentication or authorization error
+// into response, with WWW-Authenticate challenge for 401 responses.
+func (app *application) authErrorJSON(w http.ResponseWriter, e *authError) {
+	if e.status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="`+e.code+`"`)
+	}
+
+	app.errorCodeJSON(w, e, e.code, e.status)
+}
+
+// hasClaim function reports whether token contains claim.
+func hasClaim(claims *jwt.Claims, name string) bool {
+	switch name {
+	case "exp":
+		return claims.Expires != nil
+	case "aud":
+		return len(claims.Audiences) > 0
+	default:
+		v, ok := claims.String(name)
+		return ok && v != ""
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"backend/models"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+func TestAuthenticateClaims(t *testing.T) {
+	ta := newTestApp(t)
+	ta.app.config.jwt.audiences = "test.local, other.local"
+
+	now := time.Now()
+
+	// claims function returns claims of valid editor's token changed by fn
+	claims := func(fn func(c *jwt.Claims)) *jwt.Claims {
+		var c jwt.Claims
+		c.Set = map[string]interface{}{"role": models.RoleEditor}
+		c.ID = "test"
+		c.Subject = "2"
+		c.Issuer = "test.local"
+		c.Audiences = []string{"test.local"}
+		c.Issued = jwt.NewNumericTime(now)
+		c.NotBefore = jwt.NewNumericTime(now)
+		c.Expires = jwt.NewNumericTime(now.Add(time.Minute))
+		if fn != nil {
+			fn(&c)
+		}
+		return &c
+	}
+
+	tests := []struct {
+		name   string
+		claims *jwt.Claims
+		secret string
+		// Authorization header, if token isn't signed from claims
+		header string
+		status int
+		code   string
+	}{
+		{
+			name:   "valid token",
+			claims: claims(nil),
+			status: http.StatusOK,
+		},
+		{
+			name:   "other configured audience",
+			claims: claims(func(c *jwt.Claims) { c.Audiences = []string{"other.local"} }),
+			status: http.StatusOK,
+		},
+		{
+			name:   "any of audiences",
+			claims: claims(func(c *jwt.Claims) { c.Audiences = []string{"unknown.local", "other.local"} }),
+			status: http.StatusOK,
+		},
+		{
+			name:   "unknown audience",
+			claims: claims(func(c *jwt.Claims) { c.Audiences = []string{"unknown.local"} }),
+			status: http.StatusUnauthorized,
+			code:   ErrCodeInvalidAudience,
+		},
+		{
+			name:   "unknown issuer",
+			claims: claims(func(c *jwt.Claims) { c.Issuer = "unknown.local" }),
+			status: http.StatusUnauthorized,
+			code:   ErrCodeInvalidIssuer,
+		},
+		{
+			name:   "missing ID",
+			claims: claims(func(c *jwt.Claims) { c.ID = "" }),
+			status: http.StatusUnauthorized,
+			code:   ErrCodeMissingClaim,
+		},
+		{
+			name:   "missing role",
+			claims: claims(func(c *jwt.Claims) { delete(c.Set, "role") }),
+			status: http.StatusUnauthorized,
+			code:   ErrCodeMissingClaim,
+		},
+		{
+			name:   "missing expiry",
+			claims: claims(func(c *jwt.Claims) { c.Expires = nil }),
+			status: http.StatusUnauthorized,
+			code:   ErrCodeMissingClaim,
+		},
+		{
+			name:   "expired within leeway",
+			claims: claims(func(c *jwt.Claims) { c.Expires = jwt.NewNumericTime(now.Add(-30 * time.Second)) }),
+			status: http.StatusOK,
+		},
+		{
+			name:   "expired",
+			claims: claims(func(c *jwt.Claims) { c.Expires = jwt.NewNumericTime(now.Add(-2 * time.Minute)) }),
+			status: http.StatusUnauthorized,
+			code:   ErrCodeTokenExpired,
+		},
+		{
+			name:   "not valid yet",
+			claims: claims(func(c *jwt.Claims) { c.NotBefore = jwt.NewNumericTime(now.Add(5 * time.Minute)) }),
+			status: http.StatusUnauthorized,
+			code:   ErrCodeTokenNotYetValid,
+		},
+		{
+			name:   "subject is not user ID",
+			claims: claims(func(c *jwt.Claims) { c.Subject = "editor@test.local" }),
+			status: http.StatusUnauthorized,
+			code:   ErrCodeInvalidClaim,
+		},
+		{
+			name:   "unknown role",
+			claims: claims(func(c *jwt.Claims) { c.Set["role"] = "owner" }),
+			status: http.StatusUnauthorized,
+			code:   ErrCodeInvalidClaim,
+		},
+		{
+			name:   "other secret",
+			claims: claims(nil),
+			secret: "other-secret",
+			status: http.StatusUnauthorized,
+			code:   ErrCodeInvalidSignature,
+		},
+		{
+			name:   "not bearer token",
+			header: "Token test",
+			status: http.StatusUnauthorized,
+			code:   ErrCodeInvalidHeader,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := tt.header
+			if tt.claims != nil {
+				secret := tt.secret
+				if secret == "" {
+					secret = ta.app.config.jwt.secret
+				}
+
+				token, err := tt.claims.HMACSign(jwt.HS256, []byte(secret))
+				if err != nil {
+					t.Fatal(err)
+				}
+				header = "Bearer " + string(token)
+			}
+
+			res := ta.request(t, http.MethodGet, "/v1/movies/1/revisions", "", "", map[string]string{
+				"Authorization": header,
+			})
+			checkResponse(t, res, tt.status, tt.code)
+
+			if tt.status == http.StatusUnauthorized {
+				if challenge := res.Header().Get("WWW-Authenticate"); !strings.Contains(challenge, tt.code) {
+					t.Errorf("WWW-Authenticate %q, expected %s code", challenge, tt.code)
+				}
+			}
+		})
+	}
+}
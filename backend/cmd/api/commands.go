@@ -0,0 +1,234 @@
+package main
+
+import (
+	"backend/fixtures"
+	"backend/migrations"
+	"backend/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DB_USERS_MOCKUP_FILE is a default path to legacy users file, which may be
+// imported into the store by import-users command
+const DB_USERS_MOCKUP_FILE = "./data/user/users.json"
+
+// readCommand function takes command name from the first command-line
+// argument and removes it from os.Args, so flags can be parsed as usual.
+// Returns "serve" if no command provided.
+func readCommand() string {
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
+		return "serve"
+	}
+
+	command := os.Args[1]
+	os.Args = append(os.Args[:1], os.Args[2:]...)
+
+	return command
+}
+
+// importUsers command reads users from legacy JSON file (see
+// data/user/users.example.json) and creates them in the store. Passwords
+// must already be bcrypt hashes, they are imported as is. Imported users
+// get viewer role and unverified emails, unless -role and -verified flags
+// following the file path say otherwise. Users with already taken emails
+// are skipped, so command may be safely rerun.
+func (app *application) importUsers(args ...string) error {
+	fs := flag.NewFlagSet("import-users", flag.ContinueOnError)
+	role := fs.String("role", models.RoleViewer, "Role of imported users")
+	verified := fs.Bool("verified", false, "Consider emails of imported users verified")
+
+	// Flags may follow the path
+	path := DB_USERS_MOCKUP_FILE
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		path, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected import-users arguments: %v", fs.Args())
+	}
+
+	if !models.ValidRole(*role) {
+		return fmt.Errorf("unknown role: %s", *role)
+	}
+
+	bu, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read users file: %+v", err)
+	}
+
+	var fileUsers []struct {
+		ID       int    `json:"id"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := json.Unmarshal(bu, &fileUsers); err != nil {
+		return fmt.Errorf("unable to parse users file: %+v", err)
+	}
+
+	var imported, skipped int
+	for _, fu := range fileUsers {
+		if _, err := bcrypt.Cost([]byte(fu.Password)); err != nil {
+			app.logger.Printf("Skipping user %s: password is not a bcrypt hash", fu.Email)
+			skipped++
+			continue
+		}
+
+		id, err := app.models.DB.InsertUser(models.User{
+			Email:    fu.Email,
+			Password: fu.Password,
+			Verified: *verified,
+			Role:     *role,
+		})
+		if err != nil {
+			if errors.Is(err, models.ErrDuplicateEmail) {
+				app.logger.Printf("Skipping user %s: already exists", fu.Email)
+				skipped++
+				continue
+			}
+			return fmt.Errorf("unable to import user %s: %+v", fu.Email, err)
+		}
+
+		app.logger.Printf("Imported user %s (file ID %d) as ID %d", fu.Email, fu.ID, id)
+		imported++
+	}
+
+	app.logger.Printf("Users import finished: %d imported, %d skipped", imported, skipped)
+
+	return nil
+}
+
+// setRole command changes role of user by email, e.g. to grant admin role
+// to the first registered user.
+func (app *application) setRole(email, role string) error {
+	if !models.ValidRole(role) {
+		return fmt.Errorf("unknown role: %s", role)
+	}
+
+	user, err := app.models.DB.GetUserByEmail(email)
+	if err != nil {
+		return fmt.Errorf("unable to get user %s: %+v", email, err)
+	}
+
+	if err := app.models.DB.SetUserRole(user.ID, role); err != nil {
+		return fmt.Errorf("unable to set role of user %s: %+v", email, err)
+	}
+
+	app.logger.Printf("User %s role set to %s", email, role)
+
+	return nil
+}
+
+// migrate command runs database migrations (see backend/migrations):
+//   - up - apply all pending migrations;
+//   - down [steps] - revert the latest steps migrations, 1 by default;
+//   - to <version> - migrate up or down to version;
+//   - force <version> - mark migrations up to version as applied without
+//     running them, for databases migrated manually before;
+//   - status - list migrations and their apply time.
+func (app *application) migrate(action, arg string) error {
+	if app.db == nil {
+		return errors.New("migrations are supported by postgres store only")
+	}
+
+	migrator, err := migrations.New(app.db, app.logger)
+	if err != nil {
+		return err
+	}
+
+	// Migrations may take long, so they run without timeout
+	ctx := context.Background()
+
+	switch action {
+	case "up":
+		return migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if arg != "" {
+			steps, err = strconv.Atoi(arg)
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps: %s", arg)
+			}
+		}
+		return migrator.Down(ctx, steps)
+	case "to", "force":
+		version, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid migration version: %s", arg)
+		}
+		if action == "force" {
+			return migrator.Force(ctx, version)
+		}
+		return migrator.To(ctx, version)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown migrate action %q, expected up, down, to, force or status", action)
+	}
+}
+
+// seed command loads movies, genres and their links from fixture files
+// (see backend/fixtures) into the store. Without files the bundled sample
+// dataset is loaded. Records are matched by natural keys, so command may be
+// safely rerun after fixtures are changed. Changes are audited on behalf of
+// system actor.
+func (app *application) seed(paths ...string) error {
+	var sets []*fixtures.Fixtures
+
+	if len(paths) == 0 {
+		f, err := fixtures.Sample()
+		if err != nil {
+			return err
+		}
+		sets = append(sets, f)
+		paths = []string{"sample dataset"}
+	}
+
+	for _, path := range paths[len(sets):] {
+		f, err := fixtures.Load(path)
+		if err != nil {
+			return err
+		}
+		sets = append(sets, f)
+	}
+
+	store := app.models.DB.WithActor(models.SystemActor("seed"))
+	for i, f := range sets {
+		result, err := f.Seed(store)
+		if err != nil {
+			return err
+		}
+
+		app.logger.Printf(
+			"Seeded %s: %d genres, %d movies, %d movie genres",
+			paths[i], result.Genres, result.Movies, result.Links,
+		)
+	}
+
+	return nil
+}
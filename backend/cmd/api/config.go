@@ -1,18 +1,77 @@
 package main
 
+import (
+	"strings"
+	"time"
+)
+
 const (
-	version = "0.0.1"
+	version = "0.1.0"
 )
 
 type config struct {
-	port int
-	env  string
-	db   struct {
+	port  int
+	env   string
+	store string
+	db    struct {
 		dsn string
+		// Apply pending migrations on server startup
+		migrate bool
 	}
 	jwt struct {
 		audiences string
 		issuer    string
 		secret    string
+		// Directory of asymmetric keys and ID of the one signing tokens
+		keysDir    string
+		signingKey string
+		// HMAC tokens are accepted with keys directory until this RFC 3339
+		// time, empty rejects them
+		hmacUntil string
+		// Lifetime of access and refresh tokens
+		ttl        time.Duration
+		refreshTTL time.Duration
+		// Allowed clock skew on token expiry and not-before checks
+		leeway time.Duration
+	}
+	mailer struct {
+		kind   string
+		dir    string
+		sender string
+		smtp   struct {
+			host     string
+			port     int
+			username string
+			password string
+		}
 	}
+	// Base URL of frontend app, used for links in emails
+	appURL string
+	// Load sample dataset into the store on server startup
+	seed bool
+	// Deleted movies are purged from trash after retention, 0 keeps them
+	trashRetention time.Duration
+	graphql        struct {
+		// Limits of query depth and complexity, 0 disables the limit
+		maxDepth      int
+		maxComplexity int
+		// JSON file of persisted queries by their SHA-256 hashes, and
+		// whether only they are allowed
+		persistedQueries string
+		persistedOnly    bool
+	}
+}
+
+// jwtAudiences function returns list of configured JWT audiences. New tokens
+// are issued for all of them, tokens for any of them are accepted.
+func (cfg config) jwtAudiences() []string {
+	var audiences []string
+
+	for _, aud := range strings.Split(cfg.jwt.audiences, ",") {
+		if aud = strings.TrimSpace(aud); aud != "" {
+			audiences = append(audiences, aud)
+		}
+	}
+
+	return audiences
 }
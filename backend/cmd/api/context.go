@@ -0,0 +1,78 @@
+package main
+
+import (
+	"backend/models"
+	"context"
+	"net/http"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+// contextKey is a type for application's request context keys, so they
+// never collide with keys of other packages.
+type contextKey string
+
+const (
+	// userContextKey is a request context key of authenticated user
+	userContextKey = contextKey("user")
+	// claimsContextKey is a request context key of access token claims
+	claimsContextKey = contextKey("claims")
+	// requestIDContextKey is a request context key of request ID
+	requestIDContextKey = contextKey("request_id")
+)
+
+// contextSetUser function returns a copy of request with authenticated user
+// placed into its context.
+func (app *application) contextSetUser(r *http.Request, user *models.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// contextGetUser function returns authenticated user from request context
+// or nil, if request is not authenticated.
+func (app *application) contextGetUser(r *http.Request) *models.User {
+	user, _ := r.Context().Value(userContextKey).(*models.User)
+	return user
+}
+
+// contextSetClaims function returns a copy of request with access token
+// claims placed into its context.
+func (app *application) contextSetClaims(r *http.Request, claims *jwt.Claims) *http.Request {
+	ctx := context.WithValue(r.Context(), claimsContextKey, claims)
+	return r.WithContext(ctx)
+}
+
+// contextGetClaims function returns access token claims from request
+// context or nil, if request is not authenticated.
+func (app *application) contextGetClaims(r *http.Request) *jwt.Claims {
+	claims, _ := r.Context().Value(claimsContextKey).(*jwt.Claims)
+	return claims
+}
+
+// contextSetRequestID function returns a copy of request with request ID
+// placed into its context.
+func (app *application) contextSetRequestID(r *http.Request, id string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+	return r.WithContext(ctx)
+}
+
+// contextGetRequestID function returns request ID from request context.
+func (app *application) contextGetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+// storeFor function returns store auditing catalogue changes on behalf of
+// authenticated user of request, or the plain store if request is not
+// authenticated.
+func (app *application) storeFor(r *http.Request) models.Store {
+	user := app.contextGetUser(r)
+	if user == nil {
+		return app.models.DB
+	}
+
+	return app.models.DB.WithActor(models.Actor{
+		UserID:    user.ID,
+		RequestID: app.contextGetRequestID(r),
+	})
+}
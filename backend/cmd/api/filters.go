@@ -0,0 +1,200 @@
+package main
+
+import (
+	"backend/models"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Page size of movies listing when offset or cursor is provided without
+	// limit parameter
+	DEFAULT_PAGE_LIMIT = 20
+	// Maximum page size of movies listing client may request
+	MAX_PAGE_LIMIT = 100
+)
+
+// readMovieFilter function reads movies listing options from query string:
+//   - limit, offset: page size and offset (offset is ignored with cursor),
+//     all movies are listed if none of limit, offset and cursor is set;
+//   - cursor: next_cursor value from previous page metadata;
+//   - sort: one of models.MovieSortFields, order: asc|desc;
+//   - year_min, year_max, rating_min, rating_max: inclusive ranges;
+//   - mpaa_rating, genre_id: lists of values, either repeated or separated
+//     by comma.
+func readMovieFilter(qs url.Values) (models.MovieFilter, error) {
+	var filter models.MovieFilter
+	var err error
+
+	filter.Cursor = qs.Get("cursor")
+
+	// Clients not aware of pagination keep getting the whole catalogue, zero
+	// limit lists all movies
+	paginated := qs.Get("limit") != "" || qs.Get("offset") != "" || filter.Cursor != ""
+	if paginated {
+		filter.Limit, err = readInt(qs, "limit", DEFAULT_PAGE_LIMIT)
+		if err != nil {
+			return filter, err
+		}
+		if filter.Limit < 1 || filter.Limit > MAX_PAGE_LIMIT {
+			return filter, fmt.Errorf("limit parameter must be between 1 and %d", MAX_PAGE_LIMIT)
+		}
+	}
+
+	filter.Offset, err = readInt(qs, "offset", 0)
+	if err != nil {
+		return filter, err
+	}
+	if filter.Offset < 0 {
+		return filter, fmt.Errorf("offset parameter must not be negative")
+	}
+
+	filter.Sort = qs.Get("sort")
+	if filter.Sort == "" {
+		filter.Sort = "title"
+	}
+	if !models.ValidSortField(filter.Sort) {
+		return filter, fmt.Errorf(
+			"sort parameter must be one of: %s",
+			strings.Join(models.MovieSortFields, ", "),
+		)
+	}
+
+	switch qs.Get("order") {
+	case "", "asc":
+	case "desc":
+		filter.Desc = true
+	default:
+		return filter, fmt.Errorf("order parameter must be asc or desc")
+	}
+
+	ranges := map[string]**int{
+		"year_min":   &filter.YearMin,
+		"year_max":   &filter.YearMax,
+		"rating_min": &filter.RatingMin,
+		"rating_max": &filter.RatingMax,
+	}
+	for key, dst := range ranges {
+		if qs.Get(key) == "" {
+			continue
+		}
+
+		v, err := readInt(qs, key, 0)
+		if err != nil {
+			return filter, err
+		}
+		*dst = &v
+	}
+
+	filter.MPAARatings = readList(qs, "mpaa_rating")
+
+	for _, s := range readList(qs, "genre_id") {
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			return filter, fmt.Errorf("invalid genre_id parameter: %s", s)
+		}
+		filter.GenreIDs = append(filter.GenreIDs, id)
+	}
+
+	return filter, nil
+}
+
+// readAuditFilter function reads audit log query options from query string:
+//   - entity: movie|genre, entity_id: ID of entity, actor_id: ID of user;
+//   - from, to: time range in RFC 3339 format, from is inclusive, to is not;
+//   - limit, offset: page size and offset.
+func readAuditFilter(qs url.Values) (models.AuditFilter, error) {
+	var filter models.AuditFilter
+	var err error
+
+	filter.Limit, err = readInt(qs, "limit", DEFAULT_PAGE_LIMIT)
+	if err != nil {
+		return filter, err
+	}
+	if filter.Limit < 1 || filter.Limit > MAX_PAGE_LIMIT {
+		return filter, fmt.Errorf("limit parameter must be between 1 and %d", MAX_PAGE_LIMIT)
+	}
+
+	filter.Offset, err = readInt(qs, "offset", 0)
+	if err != nil {
+		return filter, err
+	}
+	if filter.Offset < 0 {
+		return filter, fmt.Errorf("offset parameter must not be negative")
+	}
+
+	filter.Entity = qs.Get("entity")
+	switch filter.Entity {
+	case "", models.EntityMovie, models.EntityGenre:
+	default:
+		return filter, fmt.Errorf("entity parameter must be %s or %s", models.EntityMovie, models.EntityGenre)
+	}
+
+	ids := map[string]**int{
+		"entity_id": &filter.EntityID,
+		"actor_id":  &filter.ActorID,
+	}
+	for key, dst := range ids {
+		if qs.Get(key) == "" {
+			continue
+		}
+
+		v, err := readInt(qs, key, 0)
+		if err != nil {
+			return filter, err
+		}
+		*dst = &v
+	}
+
+	times := map[string]**time.Time{
+		"from": &filter.From,
+		"to":   &filter.To,
+	}
+	for key, dst := range times {
+		if qs.Get(key) == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, qs.Get(key))
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s parameter: must be a time in RFC 3339 format", key)
+		}
+		*dst = &t
+	}
+
+	return filter, nil
+}
+
+// readInt function returns query string parameter as integer or default
+// value if parameter is not set.
+func readInt(qs url.Values, key string, defaultValue int) (int, error) {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s parameter: must be an integer", key)
+	}
+
+	return v, nil
+}
+
+// readList function returns all values of query string parameter, either
+// repeated (?key=a&key=b) or separated by comma (?key=a,b).
+func readList(qs url.Values, key string) []string {
+	var list []string
+	for _, v := range qs[key] {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+	}
+
+	return list
+}
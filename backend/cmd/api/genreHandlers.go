@@ -0,0 +1,182 @@
+package main
+
+import (
+	"backend/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// MAX_GENRE_NAME_LENGTH is a maximum length of genre name in characters
+const MAX_GENRE_NAME_LENGTH = 100
+
+// GenrePayload type is a client payload of genre create and rename APIs.
+type GenrePayload struct {
+	GenreName string `json:"genre_name"`
+}
+
+// MergePayload type is a client payload of genres merge API, TargetID is
+// ID of genre which survives the merge.
+type MergePayload struct {
+	TargetID int `json:"target_id"`
+}
+
+// createGenre API handler creates a new genre, responds with 201 Created
+// and the genre.
+func (app *application) createGenre(w http.ResponseWriter, r *http.Request) {
+	name, err := readGenreName(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	id, err := app.storeFor(r).InsertGenre(models.Genre{GenreName: name})
+	if err != nil {
+		app.genreWriteError(w, err)
+		return
+	}
+
+	app.writeGenre(w, http.StatusCreated, id)
+
+}
+
+// renameGenre API handler changes name of genre by its ID.
+func (app *application) renameGenre(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	name, err := readGenreName(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.storeFor(r).UpdateGenre(models.Genre{ID: id, GenreName: name})
+	if err != nil {
+		app.genreWriteError(w, err)
+		return
+	}
+
+	app.writeGenre(w, http.StatusOK, id)
+
+}
+
+// mergeGenre API handler merges genre by its ID into target genre of
+// payload: all movies of the genre are linked with target genre instead,
+// then the genre is deleted. Responds with target genre.
+func (app *application) mergeGenre(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	var payload MergePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	if payload.TargetID == id {
+		app.errorJSON(w, errors.New("genre can't be merged into itself"))
+		return
+	}
+
+	err = app.storeFor(r).MergeGenres(id, payload.TargetID)
+	if err != nil {
+		app.genreWriteError(w, err)
+		return
+	}
+
+	app.writeGenre(w, http.StatusOK, payload.TargetID)
+
+}
+
+// deleteGenre API handler deletes genre by its ID. Genre linked with movies
+// is deleted only if cascade query string parameter is true, then all of
+// its links are deleted as well, otherwise responds with 409 Conflict.
+func (app *application) deleteGenre(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	cascade := false
+	if v := r.URL.Query().Get("cascade"); v != "" {
+		cascade, err = strconv.ParseBool(v)
+		if err != nil {
+			app.errorJSON(w, errors.New("cascade parameter must be true or false"))
+			return
+		}
+	}
+
+	err = app.storeFor(r).DeleteGenre(id, cascade)
+	if err != nil {
+		app.genreWriteError(w, err)
+		return
+	}
+
+	ok := jsonResp{
+		OK: true,
+	}
+	if err := app.writeJSON(w, http.StatusOK, ok, "response"); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+}
+
+// writeGenre function responds with genre by its ID.
+func (app *application) writeGenre(w http.ResponseWriter, status, id int) {
+	genre, err := app.models.DB.GetGenre(id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.writeJSON(w, status, genre, "genre"); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// genreWriteError function responds with error of genre change: 404 for
+// missing genre, 409 for duplicate name or genre in use, 500 otherwise.
+func (app *application) genreWriteError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrNoRecord):
+		app.errorJSON(w, errors.New("genre not found"), http.StatusNotFound)
+	case errors.Is(err, models.ErrDuplicateGenre):
+		app.errorJSON(w, errors.New("genre with this name already exists"), http.StatusConflict)
+	case errors.Is(err, models.ErrGenreInUse):
+		app.errorJSON(w, errors.New("genre is linked with movies, use cascade=true to delete it anyway"), http.StatusConflict)
+	default:
+		app.errorJSON(w, err, http.StatusInternalServerError)
+	}
+}
+
+// readGenreName function returns trimmed and validated genre name of
+// request payload.
+func readGenreName(r *http.Request) (string, error) {
+	var payload GenrePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return "", err
+	}
+
+	name := strings.TrimSpace(payload.GenreName)
+	if name == "" {
+		return "", errors.New("genre_name is required")
+	}
+
+	if len([]rune(name)) > MAX_GENRE_NAME_LENGTH {
+		return "", errors.New("genre_name must not be longer than 100 characters")
+	}
+
+	return name, nil
+}
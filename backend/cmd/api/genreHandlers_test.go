@@ -0,0 +1,88 @@
+package main
+
+import (
+	"backend/models"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestGenres(t *testing.T) {
+	ta := newTestApp(t)
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		role   string
+		body   string
+		status int
+	}{
+		{"viewer can't create", http.MethodPost, "/v1/admin/genres", models.RoleViewer, `{"genre_name":"Western"}`, http.StatusForbidden},
+		{"create", http.MethodPost, "/v1/admin/genres", models.RoleEditor, `{"genre_name":"Western"}`, http.StatusCreated},
+		{"create duplicate", http.MethodPost, "/v1/admin/genres", models.RoleEditor, `{"genre_name":" Western "}`, http.StatusConflict},
+		{"create without name", http.MethodPost, "/v1/admin/genres", models.RoleEditor, `{"genre_name":" "}`, http.StatusBadRequest},
+		{"rename", http.MethodPut, "/v1/admin/genres/11", models.RoleEditor, `{"genre_name":"Westerns"}`, http.StatusOK},
+		{"rename to taken name", http.MethodPut, "/v1/admin/genres/11", models.RoleEditor, `{"genre_name":"Drama"}`, http.StatusConflict},
+		{"rename unknown genre", http.MethodPut, "/v1/admin/genres/999", models.RoleEditor, `{"genre_name":"Noir"}`, http.StatusNotFound},
+		{"delete genre of movies", http.MethodDelete, "/v1/admin/genres/7", models.RoleEditor, "", http.StatusConflict},
+		{"merge into itself", http.MethodPost, "/v1/admin/genres/7/merge", models.RoleEditor, `{"target_id":7}`, http.StatusBadRequest},
+		{"merge into unknown genre", http.MethodPost, "/v1/admin/genres/7/merge", models.RoleEditor, `{"target_id":999}`, http.StatusNotFound},
+		{"merge", http.MethodPost, "/v1/admin/genres/7/merge", models.RoleEditor, `{"target_id":10}`, http.StatusOK},
+		{"merge merged genre", http.MethodPost, "/v1/admin/genres/7/merge", models.RoleEditor, `{"target_id":10}`, http.StatusNotFound},
+		{"delete with links", http.MethodDelete, "/v1/admin/genres/8?cascade=true", models.RoleEditor, "", http.StatusOK},
+		{"delete unused genre", http.MethodDelete, "/v1/admin/genres/11", models.RoleEditor, "", http.StatusOK},
+		{"delete deleted genre", http.MethodDelete, "/v1/admin/genres/11", models.RoleEditor, "", http.StatusNotFound},
+	}
+
+	for _, step := range steps {
+		res := ta.request(t, step.method, step.path, step.role, step.body, nil)
+		if res.Code != step.status {
+			t.Fatalf("%s: status %d, expected %d, body %s", step.name, res.Code, step.status, res.Body)
+		}
+	}
+
+	res := ta.request(t, http.MethodGet, "/v1/genres", "", "", nil)
+	checkResponse(t, res, http.StatusOK, "")
+
+	var body struct {
+		Genres []models.Genre `json:"genres"`
+	}
+	decodeBody(t, res, &body)
+
+	names := []string{}
+	for _, genre := range body.Genres {
+		names = append(names, genre.GenreName)
+	}
+	expected := []string{"Action", "Adventure", "Comedy", "Crime", "Drama", "Fantasy", "Sci-Fi", "Thriller"}
+	if !equalStrings(names, expected) {
+		t.Errorf("genres %q, expected %q", names, expected)
+	}
+
+	// Movies of merged and deleted genres are changed, so their versions
+	// are incremented
+	movies := []struct {
+		id     int
+		title  string
+		genres []string
+	}{
+		{8, "Memento", []string{"Thriller"}},
+		{9, "Casablanca", []string{"Drama"}},
+	}
+
+	for _, m := range movies {
+		res := ta.request(t, http.MethodGet, "/v1/movies/"+strconv.Itoa(m.id), "", "", nil)
+		checkResponse(t, res, http.StatusOK, "")
+
+		var body movieResponse
+		decodeBody(t, res, &body)
+
+		genres := []string{}
+		for _, name := range body.Movie.MovieGenre {
+			genres = append(genres, name)
+		}
+		if body.Movie.Title != m.title || body.Movie.Version != 2 || !equalStrings(genres, m.genres) {
+			t.Errorf("movie %+v, expected %s version 2 with genres %q", body.Movie, m.title, m.genres)
+		}
+	}
+}
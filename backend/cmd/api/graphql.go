@@ -2,69 +2,159 @@ package main
 
 import (
 	"backend/models"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"strings"
 
 	gql "github.com/graphql-go/graphql"
 )
 
-var movies []*models.Movie
+// storeContextKey is a request context key of models store, which GraphQL
+// resolvers use
+const storeContextKey = contextKey("store")
 
-var fields = gql.Fields{
-	"movie": &gql.Field{
-		Type:        movieType,
-		Description: "Get movie by id",
-		Args: gql.FieldConfigArgument{
-			"id": &gql.ArgumentConfig{
-				Type: gql.Int,
+// graphqlSchema function builds GraphQL schema of the application. It's
+// built once, resolvers get store of request by graphqlStore.
+func (app *application) graphqlSchema() (gql.Schema, error) {
+	rootQuery := gql.ObjectConfig{Name: "RootQuery", Fields: app.graphqlFields()}
+	mutation := gql.ObjectConfig{Name: "Mutation", Fields: app.graphqlMutations()}
+	schemaConfig := gql.SchemaConfig{
+		Query:    gql.NewObject(rootQuery),
+		Mutation: gql.NewObject(mutation),
+	}
+	schema, err := gql.NewSchema(schemaConfig)
+	if err != nil {
+		return schema, fmt.Errorf("failed to create GraphQL schema: %+v", err)
+	}
+
+	return schema, nil
+}
+
+// graphqlStore function returns models store of request, which is executed
+// with ctx context.
+func graphqlStore(ctx context.Context) models.Store {
+	return ctx.Value(storeContextKey).(models.Store)
+}
+
+// graphqlFields function returns root query fields, resolvers of which use
+// store of request.
+func (app *application) graphqlFields() gql.Fields {
+	return gql.Fields{
+		"movie": &gql.Field{
+			Type:        movieType,
+			Description: "Get movie by id",
+			Args: gql.FieldConfigArgument{
+				"id": &gql.ArgumentConfig{
+					Type: gql.NewNonNull(gql.Int),
+				},
 			},
-		},
-		Resolve: func(p gql.ResolveParams) (interface{}, error) {
-			id, ok := p.Args["id"].(int)
-			if ok {
-				for _, movie := range movies {
-					if movie.ID == id {
-						return movie, nil
-					}
+			Resolve: func(p gql.ResolveParams) (interface{}, error) {
+				id, _ := p.Args["id"].(int)
+
+				movie, err := graphqlStore(p.Context).Get(id)
+				if errors.Is(err, models.ErrNoRecord) {
+					return nil, nil
 				}
-			}
-			return nil, nil
+				if err != nil {
+					return nil, err
+				}
+
+				return movie, nil
+			},
 		},
-	},
 
-	"list": &gql.Field{
-		Type:        gql.NewList(movieType),
-		Description: "Get all movies",
-		Resolve: func(p gql.ResolveParams) (interface{}, error) {
-			return movies, nil
+		"list": &gql.Field{
+			Type:        gql.NewList(movieType),
+			Description: "Get page of movies ordered by title",
+			Args: gql.FieldConfigArgument{
+				"limit": &gql.ArgumentConfig{
+					Type:         gql.Int,
+					DefaultValue: MAX_PAGE_LIMIT,
+					Description:  fmt.Sprintf("Page size, at most %d", MAX_PAGE_LIMIT),
+				},
+				"offset": &gql.ArgumentConfig{
+					Type:         gql.Int,
+					DefaultValue: 0,
+				},
+			},
+			Resolve: func(p gql.ResolveParams) (interface{}, error) {
+				limit, err := graphqlIntArg(p, "limit")
+				if err != nil {
+					return nil, err
+				}
+				offset, err := graphqlIntArg(p, "offset")
+				if err != nil {
+					return nil, err
+				}
+
+				v := newValidator()
+				v.Check(limit >= 1 && limit <= MAX_PAGE_LIMIT, "limit", fmt.Sprintf("must be between 1 and %d", MAX_PAGE_LIMIT))
+				v.Check(offset >= 0, "offset", "must not be negative")
+				if !v.Valid() {
+					return nil, graphqlValidationError(v.Errors)
+				}
+
+				movies, _, err := graphqlStore(p.Context).List(models.MovieFilter{
+					Limit:  limit,
+					Offset: offset,
+					Sort:   "title",
+				})
+
+				return movies, err
+			},
 		},
-	},
 
-	"search": &gql.Field{
-		Type:        gql.NewList(movieType),
-		Description: "Search movies by title",
-		Args: gql.FieldConfigArgument{
-			"titleContains": &gql.ArgumentConfig{
-				Type: gql.String,
+		"genres": &gql.Field{
+			Type:        gql.NewList(genreType),
+			Description: "Get all genres with number of their movies",
+			Resolve: func(p gql.ResolveParams) (interface{}, error) {
+				return graphqlStore(p.Context).GenresWithCounts()
 			},
 		},
-		Resolve: func(p gql.ResolveParams) (interface{}, error) {
-			var theList []*models.Movie
-			search, ok := p.Args["titleContains"].(string)
-			if ok {
-				for _, currentMovie := range movies {
-					if strings.Contains(strings.ToLower(currentMovie.Title), strings.ToLower(search)) {
-						theList = append(theList, currentMovie)
+
+		"search": &gql.Field{
+			Type:        gql.NewList(movieType),
+			Description: "Search movies by title and description",
+			Args: gql.FieldConfigArgument{
+				"titleContains": &gql.ArgumentConfig{
+					Type: gql.String,
+				},
+				"limit": &gql.ArgumentConfig{
+					Type:         gql.Int,
+					DefaultValue: MAX_PAGE_LIMIT,
+					Description:  fmt.Sprintf("Number of the best matching movies, at most %d", MAX_PAGE_LIMIT),
+				},
+			},
+			Resolve: func(p gql.ResolveParams) (interface{}, error) {
+				limit, err := graphqlIntArg(p, "limit")
+				if err != nil {
+					return nil, err
+				}
+
+				v := newValidator()
+				v.Check(limit >= 1 && limit <= MAX_PAGE_LIMIT, "limit", fmt.Sprintf("must be between 1 and %d", MAX_PAGE_LIMIT))
+				if !v.Valid() {
+					return nil, graphqlValidationError(v.Errors)
+				}
+
+				var theList []*models.Movie
+				search, ok := p.Args["titleContains"].(string)
+				if ok {
+					results, err := graphqlStore(p.Context).Search(search, limit)
+					if err != nil {
+						return nil, err
+					}
+
+					for _, res := range results {
+						movie := res.Movie
+						theList = append(theList, &movie)
 					}
 				}
-			}
 
-			return theList, nil
+				return theList, nil
+			},
 		},
-	},
+	}
 }
 
 var movieType = gql.NewObject(
@@ -101,38 +191,67 @@ var movieType = gql.NewObject(
 			"updated_at": &gql.Field{
 				Type: gql.DateTime,
 			},
+			"version": &gql.Field{
+				Type:        gql.Int,
+				Description: "Version of movie, incremented by each update",
+			},
+			"genres": &gql.Field{
+				Type:        gql.NewList(genreType),
+				Description: "Genres of movie ordered by name",
+				Resolve: func(p gql.ResolveParams) (interface{}, error) {
+					movie := p.Source.(*models.Movie)
+					return graphqlLoad(p, graphqlLoadersFrom(p.Context).genres, movie.ID)
+				},
+			},
 		},
 	},
 )
 
-func (app *application) moviesGraphQL(w http.ResponseWriter, r *http.Request) {
-	movies, _ = app.models.DB.All()
-
-	q, _ := io.ReadAll(r.Body)
-	query := string(q)
-
-	app.logger.Println(query)
-
-	rootQuery := gql.ObjectConfig{Name: "RootQuery", Fields: fields}
-	schemaConfig := gql.SchemaConfig{Query: gql.NewObject(rootQuery)}
-	schema, err := gql.NewSchema(schemaConfig)
-	if err != nil {
-		app.errorJSON(w, fmt.Errorf("failed to create GraphQL schema: %+v", err))
-		app.logger.Println(err)
-		return
-	}
+var genreType = gql.NewObject(
+	gql.ObjectConfig{
+		Name: "Genre",
+		Fields: gql.Fields{
+			"id": &gql.Field{
+				Type: gql.Int,
+			},
+			"genre_name": &gql.Field{
+				Type: gql.String,
+			},
+			"movie_count": &gql.Field{
+				Type:        gql.Int,
+				Description: "Number of movies of genre, set by genres query only",
+			},
+		},
+	},
+)
 
-	params := gql.Params{Schema: schema, RequestString: query}
-	resp := gql.Do(params)
-	if len(resp.Errors) > 0 {
-		app.errorJSON(w, fmt.Errorf("GraphQL query request failed: %+v", resp.Errors))
-	}
+func init() {
+	// Genre and Movie types refer to each other, so the field is added
+	// after both are created
+	genreType.AddFieldConfig("movies", &gql.Field{
+		Type:        gql.NewList(movieType),
+		Description: "Movies of genre ordered by title",
+		Args: gql.FieldConfigArgument{
+			"limit": &gql.ArgumentConfig{
+				Type:         gql.Int,
+				DefaultValue: MAX_PAGE_LIMIT,
+				Description:  fmt.Sprintf("Number of movies, at most %d", MAX_PAGE_LIMIT),
+			},
+		},
+		Resolve: func(p gql.ResolveParams) (interface{}, error) {
+			limit, err := graphqlIntArg(p, "limit")
+			if err != nil {
+				return nil, err
+			}
 
-	app.logger.SetPrefix("[graphql]")
-	app.logger.Println(resp.Data)
-	j, _ := json.MarshalIndent(resp, "", "\t")
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(j)
+			v := newValidator()
+			v.Check(limit >= 1 && limit <= MAX_PAGE_LIMIT, "limit", fmt.Sprintf("must be between 1 and %d", MAX_PAGE_LIMIT))
+			if !v.Valid() {
+				return nil, graphqlValidationError(v.Errors)
+			}
 
+			genre := p.Source.(*models.Genre)
+			return graphqlLoad(p, graphqlLoadersFrom(p.Context).moviesOf(limit), genre.ID)
+		},
+	})
 }
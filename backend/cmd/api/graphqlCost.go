@@ -0,0 +1,197 @@
+package main
+
+import (
+	"math"
+	"strconv"
+
+	gql "github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// MAX_QUERY_COST caps calculated query complexity, so it can't overflow
+const MAX_QUERY_COST = math.MaxInt32
+
+// fieldCost type is a cost of GraphQL field: cost of resolving field
+// itself and estimated number of items of list it returns, by which cost
+// of its selections is multiplied. If field has limit argument, list is
+// its maximum and the requested limit is used instead.
+type fieldCost struct {
+	cost  int
+	list  int
+	limit string
+}
+
+// defaultFieldCost is a cost of fields missing in graphqlCosts
+var defaultFieldCost = fieldCost{cost: 1, list: 1}
+
+// graphqlCosts are costs of fields by "Type.field" names. Root fields run
+// store queries, relationships are batched, so their own cost is low, but
+// they multiply cost of their selections.
+var graphqlCosts = map[string]fieldCost{
+	"RootQuery.movie":  {cost: 5, list: 1},
+	"RootQuery.list":   {cost: 10, list: MAX_PAGE_LIMIT, limit: "limit"},
+	"RootQuery.search": {cost: 10, list: MAX_PAGE_LIMIT, limit: "limit"},
+	"RootQuery.genres": {cost: 5, list: 20},
+	"Movie.genres":     {cost: 2, list: 5},
+	"Genre.movies":     {cost: 2, list: MAX_PAGE_LIMIT, limit: "limit"},
+
+	"Mutation.createMovie":    {cost: 20, list: 1},
+	"Mutation.updateMovie":    {cost: 20, list: 1},
+	"Mutation.setMovieGenres": {cost: 20, list: 1},
+	"Mutation.deleteMovie":    {cost: 20, list: 1},
+}
+
+// queryAnalyzer type calculates depth and complexity of GraphQL operation
+// by its AST, before the operation is executed.
+type queryAnalyzer struct {
+	schema    *gql.Schema
+	fragments map[string]*ast.FragmentDefinition
+	op        *ast.OperationDefinition
+	variables map[string]interface{}
+}
+
+// analyzeQuery function returns depth of the most nested field of
+// operation and its complexity: sum of costs of all fields, multiplied by
+// estimated sizes of lists they are selected from. Document must be
+// validated, so its fields and fragments exist and fragments have no
+// cycles. Limit arguments are read from variables, if they are set by
+// variables.
+func analyzeQuery(schema *gql.Schema, doc *ast.Document, op *ast.OperationDefinition, variables map[string]interface{}) (depth, complexity int) {
+	a := queryAnalyzer{
+		schema:    schema,
+		fragments: make(map[string]*ast.FragmentDefinition),
+		op:        op,
+		variables: variables,
+	}
+
+	for _, def := range doc.Definitions {
+		if frag, ok := def.(*ast.FragmentDefinition); ok {
+			a.fragments[frag.Name.Value] = frag
+		}
+	}
+
+	var root gql.Type = schema.QueryType()
+	if op.Operation == ast.OperationTypeMutation {
+		root = schema.MutationType()
+	}
+
+	return a.selectionSet(root, op.SelectionSet)
+}
+
+// selectionSet function returns depth and complexity of selections of
+// parent type, which is nil for introspection types.
+func (a *queryAnalyzer) selectionSet(parent gql.Type, set *ast.SelectionSet) (depth, complexity int) {
+	if set == nil {
+		return 0, 0
+	}
+
+	for _, selection := range set.Selections {
+		var d, c int
+
+		switch sel := selection.(type) {
+		case *ast.Field:
+			d, c = a.field(parent, sel)
+		case *ast.InlineFragment:
+			t := parent
+			if sel.TypeCondition != nil {
+				t = a.schema.Type(sel.TypeCondition.Name.Value)
+			}
+			d, c = a.selectionSet(t, sel.SelectionSet)
+		case *ast.FragmentSpread:
+			if frag, ok := a.fragments[sel.Name.Value]; ok {
+				d, c = a.selectionSet(a.schema.Type(frag.TypeCondition.Name.Value), frag.SelectionSet)
+			}
+		}
+
+		if d > depth {
+			depth = d
+		}
+		complexity = addCost(complexity, c)
+	}
+
+	return depth, complexity
+}
+
+// field function returns depth and complexity of field of parent type,
+// including its selections.
+func (a *queryAnalyzer) field(parent gql.Type, f *ast.Field) (depth, complexity int) {
+	// Type name is known without resolving anything
+	if f.Name.Value == "__typename" {
+		return 1, 0
+	}
+
+	cost := defaultFieldCost
+	var fieldType gql.Type
+
+	// Introspection fields aren't fields of schema types, they have
+	// default cost
+	if obj, ok := parent.(*gql.Object); ok {
+		if def, ok := obj.Fields()[f.Name.Value]; ok {
+			fieldType, _ = gql.GetNamed(def.Type).(gql.Type)
+		}
+		if c, ok := graphqlCosts[obj.Name()+"."+f.Name.Value]; ok {
+			cost = c
+		}
+	}
+
+	// Invalid limits are rejected by resolver, so they cost as the maximum
+	if cost.limit != "" {
+		if limit, ok := a.intArgument(f, cost.limit); ok && limit > 0 && limit < cost.list {
+			cost.list = limit
+		}
+	}
+
+	depth, complexity = a.selectionSet(fieldType, f.SelectionSet)
+
+	if complexity > MAX_QUERY_COST/cost.list {
+		return depth + 1, MAX_QUERY_COST
+	}
+
+	return depth + 1, addCost(cost.cost, cost.list*complexity)
+}
+
+// intArgument function returns value of integer argument of field, given
+// by literal or variable. It's not ok if argument is omitted or isn't an
+// integer.
+func (a *queryAnalyzer) intArgument(f *ast.Field, name string) (int, bool) {
+	for _, arg := range f.Arguments {
+		if arg.Name.Value == name {
+			return a.intValue(arg.Value)
+		}
+	}
+
+	return 0, false
+}
+
+// intValue function returns integer of literal or variable value, variable
+// omitted from request has its default value.
+func (a *queryAnalyzer) intValue(value ast.Value) (int, bool) {
+	switch v := value.(type) {
+	case *ast.IntValue:
+		n, err := strconv.Atoi(v.Value)
+		return n, err == nil
+	case *ast.Variable:
+		if n, ok := a.variables[v.Name.Value]; ok {
+			// Variables are decoded from JSON, so numbers are float64
+			f, ok := n.(float64)
+			return int(f), ok && f == math.Trunc(f) && math.Abs(f) <= MAX_QUERY_COST
+		}
+
+		for _, def := range a.op.VariableDefinitions {
+			if def.Variable.Name.Value == v.Name.Value && def.DefaultValue != nil {
+				return a.intValue(def.DefaultValue)
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// addCost function returns sum of costs, capped by MAX_QUERY_COST.
+func addCost(a, b int) int {
+	if a > MAX_QUERY_COST-b {
+		return MAX_QUERY_COST
+	}
+
+	return a + b
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// nestedGenresQuery function returns query of genres with movies nested
+// into each other levels times.
+func nestedGenresQuery(levels int) string {
+	return strings.Repeat("{ genres { movies ", levels) + "{ title }" + strings.Repeat(" } }", levels)
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	ta := newTestApp(t)
+
+	const nested = `genres { movies { genres { genre_name } } }`
+
+	ta.runGraphQLTests(t, []graphqlTest{
+		{
+			name:  "allowed depth",
+			query: nestedGenresQuery(1),
+		},
+		{
+			name:  "depth above limit",
+			query: nestedGenresQuery(8),
+			code:  "query_too_deep",
+		},
+		{
+			name:  "complexity above limit",
+			query: `{ genres { movies { genres { movies { title } } } } }`,
+			code:  "query_too_complex",
+		},
+		{
+			name:  "complexity of fragments",
+			query: `{ genres { ...movies } } fragment movies on Genre { movies { genres { movies { title } } } }`,
+			code:  "query_too_complex",
+		},
+		{
+			name:  "movies of genre complexity by limit",
+			query: `{ genres { movies(limit: 1) { genres { movies(limit: 1) { title } } } } }`,
+		},
+		{
+			name:      "list complexity by limit variable",
+			query:     `query($limit: Int) { list(limit: $limit) { ` + nested + ` } }`,
+			variables: map[string]interface{}{"limit": 1},
+		},
+		{
+			name:      "list complexity by maximum limit",
+			query:     `query($limit: Int) { list(limit: $limit) { ` + nested + ` } }`,
+			variables: map[string]interface{}{"limit": 100},
+			code:      "query_too_complex",
+		},
+		{
+			name:  "search complexity by limit",
+			query: `{ search(titleContains: "time", limit: 1) { ` + nested + ` } }`,
+		},
+		{
+			name:  "search complexity by default limit",
+			query: `{ search(titleContains: "time") { ` + nested + ` } }`,
+			code:  "query_too_complex",
+		},
+		{
+			name:  "search limit",
+			query: `{ search(titleContains: "time", limit: 1) { title } }`,
+			data:  `{"search":[{"title":"Back to the Future"}]}`,
+		},
+		{
+			name:  "search limit above maximum",
+			query: `{ search(titleContains: "time", limit: 101) { title } }`,
+			code:  "validation_failed",
+		},
+	})
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	gql "github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+const (
+	// Maximum size of GraphQL request body in bytes
+	MAX_GRAPHQL_BODY = 1 << 20
+	// Media types of GraphQL-over-HTTP requests and responses
+	GRAPHQL_JSON     = "application/json"
+	GRAPHQL_QUERY    = "application/graphql"
+	GRAPHQL_RESPONSE = "application/graphql-response+json"
+)
+
+// graphqlRequest is a type of GraphQL-over-HTTP request parameters.
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+	Extensions    graphqlExtensions      `json:"extensions"`
+}
+
+// graphqlExtensions is a type of GraphQL request extensions supported by
+// the application.
+type graphqlExtensions struct {
+	PersistedQuery *persistedQueryExtension `json:"persistedQuery"`
+}
+
+// graphqlResponse is a type of GraphQL-over-HTTP response payload, data is
+// omitted if request isn't executed.
+type graphqlResponse struct {
+	Data   interface{}                `json:"data,omitempty"`
+	Errors []gqlerrors.FormattedError `json:"errors,omitempty"`
+}
+
+// graphqlRequestError type is an error of GraphQL-over-HTTP request which
+// can't be executed, with status of response and optional machine-readable
+// code.
+type graphqlRequestError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *graphqlRequestError) Error() string {
+	return e.message
+}
+
+// Extensions function returns code of error for GraphQL response.
+func (e *graphqlRequestError) Extensions() map[string]interface{} {
+	if e.code == "" {
+		return nil
+	}
+
+	return map[string]interface{}{"code": e.code}
+}
+
+// moviesGraphQL API handler executes GraphQL request by GraphQL-over-HTTP
+// specification: POST with JSON body of query, variables and operation
+// name (or application/graphql body of query only), or GET with the same
+// query string parameters for queries. Query may be sent as hash of
+// persisted one. Queries over depth and complexity limits are rejected
+// before execution. Response is application/json, or
+// application/graphql-response+json if client accepts it.
+func (app *application) moviesGraphQL(w http.ResponseWriter, r *http.Request) {
+	mediaType := graphqlMediaType(r)
+
+	req, err := readGraphQLRequest(w, r)
+	if err != nil {
+		app.graphqlRequestFailed(w, mediaType, err)
+		return
+	}
+
+	if err := app.persistedQuery(req); err != nil {
+		app.graphqlRequestFailed(w, mediaType, err)
+		return
+	}
+
+	if strings.TrimSpace(req.Query) == "" {
+		app.graphqlRequestFailed(w, mediaType, &graphqlRequestError{status: http.StatusBadRequest, message: "query is required"})
+		return
+	}
+
+	// Documents which can't be executed are client errors for clients of
+	// graphql-response+json, plain JSON clients always get 200 OK
+	failedStatus := http.StatusOK
+	if mediaType == GRAPHQL_RESPONSE {
+		failedStatus = http.StatusBadRequest
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		app.writeGraphQL(w, mediaType, failedStatus, &graphqlResponse{Errors: graphqlErrors(err)})
+		return
+	}
+
+	validation := gql.ValidateDocument(&app.graphql, doc, nil)
+	if !validation.IsValid {
+		app.writeGraphQL(w, mediaType, failedStatus, &graphqlResponse{Errors: validation.Errors})
+		return
+	}
+
+	op := graphqlOperation(doc, req.OperationName)
+	if op == nil {
+		err := fmt.Errorf("unknown operation %q", req.OperationName)
+		if req.OperationName == "" {
+			err = errors.New("operationName is required for document with several operations")
+		}
+		app.writeGraphQL(w, mediaType, failedStatus, &graphqlResponse{Errors: graphqlErrors(err)})
+		return
+	}
+
+	// GET requests must be safe, so they may run queries only
+	if r.Method == http.MethodGet && op.Operation != ast.OperationTypeQuery {
+		w.Header().Set("Allow", http.MethodPost)
+		app.graphqlRequestFailed(w, mediaType, &graphqlRequestError{
+			status:  http.StatusMethodNotAllowed,
+			message: op.Operation + " operations are allowed by POST requests only",
+		})
+		return
+	}
+
+	// Limits are checked before execution, so expensive queries don't
+	// reach the store
+	depth, complexity := analyzeQuery(&app.graphql, doc, op, req.Variables)
+	if limit := app.config.graphql.maxDepth; limit > 0 && depth > limit {
+		app.writeGraphQL(w, mediaType, failedStatus, &graphqlResponse{Errors: graphqlErrors(&graphqlRequestError{
+			code:    "query_too_deep",
+			message: fmt.Sprintf("query depth %d exceeds maximum depth %d", depth, limit),
+		})})
+		return
+	}
+	if limit := app.config.graphql.maxComplexity; limit > 0 && complexity > limit {
+		app.writeGraphQL(w, mediaType, failedStatus, &graphqlResponse{Errors: graphqlErrors(&graphqlRequestError{
+			code:    "query_too_complex",
+			message: fmt.Sprintf("query complexity %d exceeds maximum complexity %d", complexity, limit),
+		})})
+		return
+	}
+
+	store := app.storeFor(r)
+	ctx := context.WithValue(r.Context(), storeContextKey, store)
+	ctx = context.WithValue(ctx, loadersContextKey, newGraphqlLoaders(store))
+
+	result := gql.Execute(gql.ExecuteParams{
+		Schema:        app.graphql,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       ctx,
+	})
+
+	// No data means that execution didn't start, e.g. variables are invalid
+	status := http.StatusOK
+	if result.Data == nil && result.HasErrors() {
+		status = failedStatus
+	}
+
+	app.writeGraphQL(w, mediaType, status, &graphqlResponse{Data: result.Data, Errors: result.Errors})
+
+}
+
+// readGraphQLRequest function reads GraphQL request parameters of GET
+// request query string or POST request body.
+func readGraphQLRequest(w http.ResponseWriter, r *http.Request) (*graphqlRequest, error) {
+	var req graphqlRequest
+
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+
+		if vars := q.Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				return nil, &graphqlRequestError{status: http.StatusBadRequest, message: "variables must be a JSON object"}
+			}
+		}
+
+		if ext := q.Get("extensions"); ext != "" {
+			if err := json.Unmarshal([]byte(ext), &req.Extensions); err != nil {
+				return nil, &graphqlRequestError{status: http.StatusBadRequest, message: "extensions must be a JSON object"}
+			}
+		}
+	} else {
+		r.Body = http.MaxBytesReader(w, r.Body, MAX_GRAPHQL_BODY)
+
+		contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch contentType {
+		case GRAPHQL_JSON:
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				return nil, &graphqlRequestError{status: http.StatusBadRequest, message: "invalid JSON body: " + err.Error()}
+			}
+		case GRAPHQL_QUERY:
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				return nil, &graphqlRequestError{status: http.StatusBadRequest, message: "unable to read body: " + err.Error()}
+			}
+			req.Query = string(body)
+		default:
+			return nil, &graphqlRequestError{
+				status:  http.StatusUnsupportedMediaType,
+				message: "Content-Type must be " + GRAPHQL_JSON + " or " + GRAPHQL_QUERY,
+			}
+		}
+	}
+
+	return &req, nil
+}
+
+// graphqlMediaType function returns media type of response accepted by
+// client: graphql-response+json if it's listed in Accept header, JSON
+// otherwise.
+func graphqlMediaType(r *http.Request) string {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if mediaType == GRAPHQL_RESPONSE {
+			return GRAPHQL_RESPONSE
+		}
+	}
+
+	return GRAPHQL_JSON
+}
+
+// graphqlOperation function returns operation of document by its name, or
+// the only operation if name is empty. Returns nil if it's not found.
+func graphqlOperation(doc *ast.Document, name string) *ast.OperationDefinition {
+	var found *ast.OperationDefinition
+
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+
+		if name == "" {
+			if found != nil {
+				return nil
+			}
+			found = op
+		} else if op.Name != nil && op.Name.Value == name {
+			return op
+		}
+	}
+
+	return found
+}
+
+// graphqlRequestFailed function responds with error of request which
+// can't be executed.
+func (app *application) graphqlRequestFailed(w http.ResponseWriter, mediaType string, err error) {
+	status := http.StatusBadRequest
+	var reqErr *graphqlRequestError
+	if errors.As(err, &reqErr) {
+		status = reqErr.status
+	}
+
+	app.writeGraphQL(w, mediaType, status, &graphqlResponse{Errors: graphqlErrors(err)})
+}
+
+// graphqlErrors function formats errors of request for GraphQL response,
+// keeping extensions of errors which have them.
+func graphqlErrors(errs ...error) []gqlerrors.FormattedError {
+	formatted := gqlerrors.FormatErrors(errs...)
+	for i, err := range errs {
+		if extended, ok := err.(gqlerrors.ExtendedError); ok {
+			formatted[i].Extensions = extended.Extensions()
+		}
+	}
+
+	return formatted
+}
+
+// writeGraphQL function writes GraphQL response of media type.
+func (app *application) writeGraphQL(w http.ResponseWriter, mediaType string, status int, resp *graphqlResponse) {
+	js, err := json.Marshal(resp)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaType+"; charset=utf-8")
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	w.Write(js)
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"backend/models"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+// graphqlResult type is a body of GraphQL response
+type graphqlResult struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// graphql function posts GraphQL request of user of role and returns its
+// result.
+func (ta *testApp) graphql(t *testing.T, role, query string, variables map[string]interface{}) graphqlResult {
+	t.Helper()
+
+	body := jsonBody(graphqlRequest{Query: query, Variables: variables})
+	res := ta.request(t, http.MethodPost, "/v1/graphql", role, body, nil)
+	checkResponse(t, res, http.StatusOK, "")
+
+	var result graphqlResult
+	decodeBody(t, res, &result)
+
+	return result
+}
+
+// graphqlTest type is a GraphQL request of user of role with its expected
+// result.
+type graphqlTest struct {
+	name      string
+	role      string
+	query     string
+	variables map[string]interface{}
+	// Expected data JSON, if it's checked
+	data string
+	// Expected error code, empty if no errors are expected
+	code string
+}
+
+// runGraphQLTests function runs tests one by one, so they see changes of
+// previous ones.
+func (ta *testApp) runGraphQLTests(t *testing.T, tests []graphqlTest) {
+	t.Helper()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ta.graphql(t, tt.role, tt.query, tt.variables)
+
+			if tt.code == "" {
+				if len(result.Errors) > 0 {
+					t.Fatalf("errors %+v", result.Errors)
+				}
+			} else {
+				if len(result.Errors) == 0 {
+					t.Fatalf("no errors, expected %s, data %s", tt.code, result.Data)
+				}
+				if code := result.Errors[0].Extensions["code"]; code != tt.code {
+					t.Fatalf("error code %v, expected %s, errors %+v", code, tt.code, result.Errors)
+				}
+			}
+
+			if tt.data != "" && string(result.Data) != tt.data {
+				t.Errorf("data %s, expected %s", result.Data, tt.data)
+			}
+		})
+	}
+}
+
+func TestGraphQLQueries(t *testing.T) {
+	ta := newTestApp(t)
+
+	ta.runGraphQLTests(t, []graphqlTest{
+		{
+			name:  "movie",
+			query: `{ movie(id: 1) { id title year } }`,
+			data:  `{"movie":{"id":1,"title":"The Shawshank Redemption","year":1994}}`,
+		},
+		{
+			name:  "unknown movie",
+			query: `{ movie(id: 999) { title } }`,
+			data:  `{"movie":null}`,
+		},
+		{
+			name:  "list page",
+			query: `{ list(limit: 2, offset: 1) { title } }`,
+			data:  `{"list":[{"title":"Back to the Future"},{"title":"Casablanca"}]}`,
+		},
+		{
+			name:  "list limit above maximum",
+			query: `{ list(limit: 1000) { title } }`,
+			code:  "validation_failed",
+		},
+		{
+			name:  "list negative offset",
+			query: `{ list(offset: -1) { title } }`,
+			code:  "validation_failed",
+		},
+		{
+			name:  "search",
+			query: `{ search(titleContains: "star wa") { title } }`,
+			data:  `{"search":[{"title":"Star Wars"}]}`,
+		},
+		{
+			name:  "search nothing found",
+			query: `{ search(titleContains: "zombies") { title } }`,
+			data:  `{"search":[]}`,
+		},
+	})
+}
+
+func TestGraphQLConcurrentQueries(t *testing.T) {
+	ta := newTestApp(t)
+
+	// Schema is shared by requests, so they must not race
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			res := ta.request(t, http.MethodPost, "/v1/graphql", "", `{"query":"{ list(limit: 3) { title } }"}`, nil)
+			if res.Code != http.StatusOK {
+				t.Errorf("status %d, body %s", res.Code, res.Body)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestGraphQLGenres(t *testing.T) {
+	ta := newTestApp(t)
+
+	ta.runGraphQLTests(t, []graphqlTest{
+		{
+			name:  "genres of movie",
+			query: `{ movie(id: 1) { title genres { genre_name } } }`,
+			data:  `{"movie":{"genres":[{"genre_name":"Crime"},{"genre_name":"Drama"}],"title":"The Shawshank Redemption"}}`,
+		},
+		{
+			name:  "movies of genres by limit",
+			query: `{ list(limit: 1) { title genres { genre_name movies(limit: 2) { title } } } }`,
+			data: `{"list":[{"genres":[` +
+				`{"genre_name":"Comedy","movies":[{"title":"American Psycho"},{"title":"Back to the Future"}]},` +
+				`{"genre_name":"Crime","movies":[{"title":"American Psycho"},{"title":"The Dark Knight"}]},` +
+				`{"genre_name":"Drama","movies":[{"title":"American Psycho"},{"title":"Casablanca"}]}` +
+				`],"title":"American Psycho"}]}`,
+		},
+		{
+			name:  "movies of genres by different limits",
+			query: `{ movie(id: 9) { genres { genre_name one: movies(limit: 1) { title } all: movies { title } } } }`,
+			data: `{"movie":{"genres":[` +
+				`{"all":[{"title":"American Psycho"},{"title":"Casablanca"},{"title":"The Dark Knight"},{"title":"The Godfather"},{"title":"The Shawshank Redemption"}],` +
+				`"genre_name":"Drama","one":[{"title":"American Psycho"}]},` +
+				`{"all":[{"title":"Casablanca"},{"title":"Groundhog Day"}],"genre_name":"Romance","one":[{"title":"Casablanca"}]}` +
+				`]}}`,
+		},
+		{
+			name:  "movies of genre limit above maximum",
+			query: `{ genres { movies(limit: 101) { title } } }`,
+			code:  "validation_failed",
+		},
+		{
+			name:  "movies of genre zero limit",
+			query: `{ genres { movies(limit: 0) { title } } }`,
+			code:  "validation_failed",
+		},
+	})
+
+	// Movies in trash aren't counted nor listed
+	res := ta.request(t, http.MethodDelete, "/v1/movies/4", models.RoleEditor, "", nil)
+	checkResponse(t, res, http.StatusNoContent, "")
+
+	result := ta.graphql(t, "", `{ genres { genre_name movie_count movies { title } } }`, nil)
+	if len(result.Errors) > 0 {
+		t.Fatalf("errors %+v", result.Errors)
+	}
+
+	var data struct {
+		Genres []struct {
+			GenreName  string `json:"genre_name"`
+			MovieCount int    `json:"movie_count"`
+			Movies     []struct {
+				Title string `json:"title"`
+			} `json:"movies"`
+		} `json:"genres"`
+	}
+	if err := json.Unmarshal(result.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(data.Genres) != 10 {
+		t.Fatalf("%d genres, expected 10", len(data.Genres))
+	}
+	for _, genre := range data.Genres {
+		if genre.GenreName != "Crime" {
+			continue
+		}
+
+		titles := []string{}
+		for _, movie := range genre.Movies {
+			titles = append(titles, movie.Title)
+		}
+		expected := []string{"The Dark Knight", "The Godfather", "The Shawshank Redemption"}
+		if genre.MovieCount != 3 || !equalStrings(titles, expected) {
+			t.Errorf("Crime movies %q (%d), expected %q", titles, genre.MovieCount, expected)
+		}
+	}
+}
+
+func TestGraphQLOverHTTP(t *testing.T) {
+	ta := newTestApp(t)
+
+	const operations = `query First { movie(id: 1) { title } } query Second($id: Int!) { movie(id: $id) { title } }`
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		header map[string]string
+		status int
+		// Expected media type of response
+		mediaType string
+		// Expected data JSON, empty if no data is expected
+		data string
+		// Whether errors are expected
+		failed bool
+	}{
+		{
+			name:      "JSON body with variables and operation name",
+			method:    http.MethodPost,
+			body:      jsonBody(graphqlRequest{Query: operations, OperationName: "Second", Variables: map[string]interface{}{"id": 5}}),
+			status:    http.StatusOK,
+			mediaType: GRAPHQL_JSON,
+			data:      `{"movie":{"title":"Star Wars"}}`,
+		},
+		{
+			name:      "GraphQL body",
+			method:    http.MethodPost,
+			body:      `{ movie(id: 1) { title } }`,
+			header:    map[string]string{"Content-Type": GRAPHQL_QUERY},
+			status:    http.StatusOK,
+			mediaType: GRAPHQL_JSON,
+			data:      `{"movie":{"title":"The Shawshank Redemption"}}`,
+		},
+		{
+			name:      "GET query with variables",
+			method:    http.MethodGet,
+			path:      "?query=" + url.QueryEscape(operations) + "&operationName=Second&variables=" + url.QueryEscape(`{"id":9}`),
+			status:    http.StatusOK,
+			mediaType: GRAPHQL_JSON,
+			data:      `{"movie":{"title":"Casablanca"}}`,
+		},
+		{
+			name:      "GraphQL response media type",
+			method:    http.MethodPost,
+			body:      `{"query":"{ movie(id: 1) { title } }"}`,
+			header:    map[string]string{"Accept": GRAPHQL_RESPONSE + ", " + GRAPHQL_JSON},
+			status:    http.StatusOK,
+			mediaType: GRAPHQL_RESPONSE,
+			data:      `{"movie":{"title":"The Shawshank Redemption"}}`,
+		},
+		{
+			name:      "invalid document for JSON client",
+			method:    http.MethodPost,
+			body:      `{"query":"{ movie(id: 1) { budget } }"}`,
+			status:    http.StatusOK,
+			mediaType: GRAPHQL_JSON,
+			failed:    true,
+		},
+		{
+			name:      "invalid document for GraphQL response client",
+			method:    http.MethodPost,
+			body:      `{"query":"{ movie(id: 1) { budget } }"}`,
+			header:    map[string]string{"Accept": GRAPHQL_RESPONSE},
+			status:    http.StatusBadRequest,
+			mediaType: GRAPHQL_RESPONSE,
+			failed:    true,
+		},
+		{
+			name:      "invalid variables",
+			method:    http.MethodPost,
+			body:      jsonBody(graphqlRequest{Query: operations, OperationName: "Second", Variables: map[string]interface{}{"id": "one"}}),
+			header:    map[string]string{"Accept": GRAPHQL_RESPONSE},
+			status:    http.StatusBadRequest,
+			mediaType: GRAPHQL_RESPONSE,
+			failed:    true,
+		},
+		{
+			name:      "several operations without operation name",
+			method:    http.MethodPost,
+			body:      jsonBody(graphqlRequest{Query: operations}),
+			status:    http.StatusOK,
+			mediaType: GRAPHQL_JSON,
+			failed:    true,
+		},
+		{
+			name:      "unknown operation name",
+			method:    http.MethodPost,
+			body:      jsonBody(graphqlRequest{Query: operations, OperationName: "Third"}),
+			status:    http.StatusOK,
+			mediaType: GRAPHQL_JSON,
+			failed:    true,
+		},
+		{
+			name:      "missing query",
+			method:    http.MethodPost,
+			body:      `{"variables":{"id":1}}`,
+			status:    http.StatusBadRequest,
+			mediaType: GRAPHQL_JSON,
+			failed:    true,
+		},
+		{
+			name:      "malformed JSON body",
+			method:    http.MethodPost,
+			body:      `{"query":`,
+			status:    http.StatusBadRequest,
+			mediaType: GRAPHQL_JSON,
+			failed:    true,
+		},
+		{
+			name:      "malformed variables of GET request",
+			method:    http.MethodGet,
+			path:      "?query=" + url.QueryEscape(operations) + "&variables=one",
+			status:    http.StatusBadRequest,
+			mediaType: GRAPHQL_JSON,
+			failed:    true,
+		},
+		{
+			name:      "unsupported content type",
+			method:    http.MethodPost,
+			body:      `query={ movie(id: 1) { title } }`,
+			header:    map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			status:    http.StatusUnsupportedMediaType,
+			mediaType: GRAPHQL_JSON,
+			failed:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ta.request(t, tt.method, "/v1/graphql"+tt.path, "", tt.body, tt.header)
+			if res.Code != tt.status {
+				t.Fatalf("status %d, expected %d, body %s", res.Code, tt.status, res.Body)
+			}
+
+			mediaType, _, _ := mime.ParseMediaType(res.Header().Get("Content-Type"))
+			if mediaType != tt.mediaType {
+				t.Errorf("media type %s, expected %s", mediaType, tt.mediaType)
+			}
+
+			// Response is one JSON object, even if request failed
+			var result graphqlResult
+			decodeBody(t, res, &result)
+
+			if failed := len(result.Errors) > 0; failed != tt.failed {
+				t.Errorf("errors %+v, expected errors: %t", result.Errors, tt.failed)
+			}
+			if tt.data != "" && string(result.Data) != tt.data {
+				t.Errorf("data %s, expected %s", result.Data, tt.data)
+			}
+		})
+	}
+}
+
+func TestGraphQLMutationByGET(t *testing.T) {
+	ta := newTestApp(t)
+
+	res := ta.request(t, http.MethodGet, "/v1/graphql?query=mutation%7BdeleteMovie(id:1)%7D", models.RoleEditor, "", nil)
+	checkResponse(t, res, http.StatusMethodNotAllowed, "")
+	if allow := res.Header().Get("Allow"); allow != http.MethodPost {
+		t.Errorf("Allow header %q, expected POST", allow)
+	}
+
+	res = ta.request(t, http.MethodGet, "/v1/movies/1", "", "", nil)
+	checkResponse(t, res, http.StatusOK, "")
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"backend/models"
+	"context"
+	"sync"
+
+	gql "github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// loadersContextKey is a request context key of GraphQL loaders
+const loadersContextKey = contextKey("loaders")
+
+// batchFunc type loads values of all keys by one store call, returned map
+// has no values of keys which are not found.
+type batchFunc func(keys []int) (map[int]interface{}, error)
+
+// loaded type is a value of key loaded by loader, or error of its batch.
+type loaded struct {
+	value interface{}
+	err   error
+}
+
+// loader type batches loads of values by int keys in DataLoader way:
+// resolvers queue keys and return thunks, the first thunk called loads all
+// queued keys by one batch. GraphQL executor calls thunks of query level
+// after all of its fields are resolved, so every level of query is loaded
+// by one store call. Loaded values are cached for the request.
+type loader struct {
+	batch batchFunc
+
+	mu      sync.Mutex
+	pending []int
+	queued  map[int]bool
+	cache   map[int]loaded
+}
+
+// newLoader function returns loader using batch function.
+func newLoader(batch batchFunc) *loader {
+	return &loader{
+		batch:  batch,
+		queued: make(map[int]bool),
+		cache:  make(map[int]loaded),
+	}
+}
+
+// load function queues key and returns GraphQL thunk resolving its value.
+func (l *loader) load(key int) func() (interface{}, error) {
+	l.mu.Lock()
+	if _, ok := l.cache[key]; !ok && !l.queued[key] {
+		l.queued[key] = true
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if _, ok := l.cache[key]; !ok {
+			l.dispatch()
+		}
+
+		result := l.cache[key]
+		return result.value, result.err
+	}
+}
+
+// clear function removes cached values of keys, or all cached values if
+// no keys are given, so they are loaded again. It's used after mutations.
+func (l *loader) clear(keys ...int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(keys) == 0 {
+		l.cache = make(map[int]loaded)
+		return
+	}
+
+	for _, key := range keys {
+		delete(l.cache, key)
+	}
+}
+
+// dispatch function loads all queued keys by one batch. Caller must hold
+// the lock.
+func (l *loader) dispatch() {
+	keys := l.pending
+	l.pending = nil
+	l.queued = make(map[int]bool)
+
+	values, err := l.batch(keys)
+	for _, key := range keys {
+		l.cache[key] = loaded{value: values[key], err: err}
+	}
+}
+
+// graphqlLoad function returns result of resolver loading value of key by
+// l: thunk for queries, so every level of query is batched, and the value
+// itself for mutations, which are executed serially and must see changes
+// of previous ones.
+func graphqlLoad(p gql.ResolveParams, l *loader, key int) (interface{}, error) {
+	thunk := l.load(key)
+
+	op, ok := p.Info.Operation.(*ast.OperationDefinition)
+	if ok && op.Operation == ast.OperationTypeMutation {
+		return thunk()
+	}
+
+	return thunk, nil
+}
+
+// graphqlLoaders type has loaders of GraphQL relationships of one request.
+type graphqlLoaders struct {
+	store models.Store
+	// Genres by movie ID
+	genres *loader
+
+	mu sync.Mutex
+	// Movies by genre ID, one loader of every limit of movies requested
+	movies map[int]*loader
+}
+
+// newGraphqlLoaders function returns loaders using store of request.
+func newGraphqlLoaders(store models.Store) *graphqlLoaders {
+	return &graphqlLoaders{
+		store:  store,
+		movies: make(map[int]*loader),
+		genres: newLoader(func(keys []int) (map[int]interface{}, error) {
+			genres, err := store.GenresByMovies(keys)
+			if err != nil {
+				return nil, err
+			}
+
+			values := make(map[int]interface{}, len(keys))
+			for _, key := range keys {
+				// Movies without genres have empty list, not null
+				list := genres[key]
+				if list == nil {
+					list = []*models.Genre{}
+				}
+				values[key] = list
+			}
+
+			return values, nil
+		}),
+	}
+}
+
+// moviesOf function returns loader of up to limit movies by genre ID.
+func (loaders *graphqlLoaders) moviesOf(limit int) *loader {
+	loaders.mu.Lock()
+	defer loaders.mu.Unlock()
+
+	if l, ok := loaders.movies[limit]; ok {
+		return l
+	}
+
+	l := newLoader(func(keys []int) (map[int]interface{}, error) {
+		movies, err := loaders.store.MoviesByGenres(keys, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		values := make(map[int]interface{}, len(keys))
+		for _, key := range keys {
+			list := movies[key]
+			if list == nil {
+				list = []*models.Movie{}
+			}
+			values[key] = list
+		}
+
+		return values, nil
+	})
+	loaders.movies[limit] = l
+
+	return l
+}
+
+// movieChanged function clears cached relationships of movie by its ID
+// after it's changed by mutation.
+func (loaders *graphqlLoaders) movieChanged(id int) {
+	loaders.genres.clear(id)
+
+	loaders.mu.Lock()
+	defer loaders.mu.Unlock()
+
+	for _, l := range loaders.movies {
+		l.clear()
+	}
+}
+
+// graphqlLoadersFrom function returns loaders of request, which is
+// executed with ctx context.
+func graphqlLoadersFrom(ctx context.Context) *graphqlLoaders {
+	return ctx.Value(loadersContextKey).(*graphqlLoaders)
+}
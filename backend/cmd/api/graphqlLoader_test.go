@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestLoader(t *testing.T) {
+	var batches [][]int
+	l := newLoader(func(keys []int) (map[int]interface{}, error) {
+		batches = append(batches, keys)
+
+		values := make(map[int]interface{})
+		for _, key := range keys {
+			values[key] = key * 10
+		}
+		return values, nil
+	})
+
+	// Keys queued before the first thunk is called are loaded together
+	thunks := []func() (interface{}, error){l.load(1), l.load(2), l.load(1)}
+	for i, expected := range []int{10, 20, 10} {
+		value, err := thunks[i]()
+		if err != nil || value != expected {
+			t.Fatalf("value %v, error %v, expected %d", value, err, expected)
+		}
+	}
+
+	// Loaded values are cached until they are cleared
+	if value, _ := l.load(2)(); value != 20 {
+		t.Fatalf("cached value %v, expected 20", value)
+	}
+	l.clear(1)
+	if value, _ := l.load(1)(); value != 10 {
+		t.Fatalf("reloaded value %v, expected 10", value)
+	}
+
+	if len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 1 || batches[1][0] != 1 {
+		t.Errorf("batches %v, expected [1 2] and [1]", batches)
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"backend/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	gql "github.com/graphql-go/graphql"
+)
+
+// graphqlError type is an error of GraphQL resolver, its machine-readable
+// code and invalid fields are responded in error extensions.
+type graphqlError struct {
+	code    string
+	message string
+	fields  map[string]string
+}
+
+func (e *graphqlError) Error() string {
+	return e.message
+}
+
+// Extensions function returns details of error for GraphQL response.
+func (e *graphqlError) Extensions() map[string]interface{} {
+	ext := map[string]interface{}{"code": e.code}
+	if len(e.fields) > 0 {
+		ext["fields"] = e.fields
+	}
+
+	return ext
+}
+
+// graphqlValidationError function returns error of invalid mutation input
+// with error messages by input fields.
+func graphqlValidationError(fields map[string]string) error {
+	return &graphqlError{
+		code:    "validation_failed",
+		message: "invalid input, see fields for details",
+		fields:  fields,
+	}
+}
+
+// movieInputType is a GraphQL input object of movie create and update
+// mutations, its fields are the ones of MovieInput.
+var movieInputType = gql.NewInputObject(
+	gql.InputObjectConfig{
+		Name: "MovieInput",
+		Fields: gql.InputObjectConfigFieldMap{
+			"title": &gql.InputObjectFieldConfig{
+				Type: gql.String,
+			},
+			"description": &gql.InputObjectFieldConfig{
+				Type: gql.String,
+			},
+			"release_date": &gql.InputObjectFieldConfig{
+				Type:        gql.String,
+				Description: "Release date in YYYY-MM-DD format, year is taken from it",
+			},
+			"runtime": &gql.InputObjectFieldConfig{
+				Type: gql.Int,
+			},
+			"rating": &gql.InputObjectFieldConfig{
+				Type: gql.Int,
+			},
+			"mpaa_rating": &gql.InputObjectFieldConfig{
+				Type: gql.String,
+			},
+			"genre_ids": &gql.InputObjectFieldConfig{
+				Type:        gql.NewList(gql.NewNonNull(gql.Int)),
+				Description: "Genres of movie, if omitted on update genres stay untouched",
+			},
+		},
+	},
+)
+
+// graphqlMutations function returns root mutation fields. Only users with
+// movies:write permission may run them.
+func (app *application) graphqlMutations() gql.Fields {
+	return gql.Fields{
+		"createMovie": &gql.Field{
+			Type:        movieType,
+			Description: "Create a new movie",
+			Args: gql.FieldConfigArgument{
+				"input": &gql.ArgumentConfig{
+					Type: gql.NewNonNull(movieInputType),
+				},
+			},
+			Resolve: func(p gql.ResolveParams) (interface{}, error) {
+				if err := app.graphqlAuthorize(p.Context, models.PermMoviesWrite); err != nil {
+					return nil, err
+				}
+
+				input, err := graphqlMovieInput(p.Args["input"])
+				if err != nil {
+					return nil, err
+				}
+
+				v := newValidator()
+
+				var movie models.Movie
+				input.apply(v, &movie)
+				validateMovie(v, &movie)
+
+				var genreIDs []int
+				if input.GenreIDs != nil {
+					genreIDs = *input.GenreIDs
+					validateGenreIDs(v, genreIDs)
+				}
+
+				if !v.Valid() {
+					return nil, graphqlValidationError(v.Errors)
+				}
+
+				now := time.Now()
+				movie.CreatedAt = now
+				movie.UpdatedAt = now
+
+				store := graphqlStore(p.Context)
+				id, err := store.InsertMovie(movie, genreIDs)
+				if err != nil {
+					return nil, graphqlMovieError(err)
+				}
+				graphqlLoadersFrom(p.Context).movieChanged(id)
+
+				return store.Get(id)
+			},
+		},
+
+		"updateMovie": &gql.Field{
+			Type:        movieType,
+			Description: "Update fields of movie present in input, if it's still of version",
+			Args: gql.FieldConfigArgument{
+				"id": &gql.ArgumentConfig{
+					Type: gql.NewNonNull(gql.Int),
+				},
+				"version": &gql.ArgumentConfig{
+					Type:        gql.NewNonNull(gql.Int),
+					Description: "Version of movie the update is based on",
+				},
+				"input": &gql.ArgumentConfig{
+					Type: gql.NewNonNull(movieInputType),
+				},
+			},
+			Resolve: func(p gql.ResolveParams) (interface{}, error) {
+				if err := app.graphqlAuthorize(p.Context, models.PermMoviesWrite); err != nil {
+					return nil, err
+				}
+
+				input, err := graphqlMovieInput(p.Args["input"])
+				if err != nil {
+					return nil, err
+				}
+
+				stored, err := app.graphqlStoredMovie(p)
+				if err != nil {
+					return nil, err
+				}
+
+				v := newValidator()
+
+				// Stored version is kept, so the update fails if movie is
+				// changed concurrently
+				movie := *stored
+				var genreIDs []int
+				if input.GenreIDs != nil {
+					genreIDs = *input.GenreIDs
+					validateGenreIDs(v, genreIDs)
+				}
+
+				// Resulting movie is validated, so update can't break it
+				input.apply(v, &movie)
+				validateMovie(v, &movie)
+
+				if !v.Valid() {
+					return nil, graphqlValidationError(v.Errors)
+				}
+				movie.UpdatedAt = time.Now()
+
+				store := graphqlStore(p.Context)
+				if err := store.UpdateMovie(movie, genreIDs); err != nil {
+					return nil, graphqlMovieError(err)
+				}
+				graphqlLoadersFrom(p.Context).movieChanged(movie.ID)
+
+				return store.Get(movie.ID)
+			},
+		},
+
+		"setMovieGenres": &gql.Field{
+			Type:        movieType,
+			Description: "Replace genres of movie, if it's still of version",
+			Args: gql.FieldConfigArgument{
+				"id": &gql.ArgumentConfig{
+					Type: gql.NewNonNull(gql.Int),
+				},
+				"version": &gql.ArgumentConfig{
+					Type:        gql.NewNonNull(gql.Int),
+					Description: "Version of movie the update is based on",
+				},
+				"genre_ids": &gql.ArgumentConfig{
+					Type: gql.NewNonNull(gql.NewList(gql.NewNonNull(gql.Int))),
+				},
+			},
+			Resolve: func(p gql.ResolveParams) (interface{}, error) {
+				if err := app.graphqlAuthorize(p.Context, models.PermMoviesWrite); err != nil {
+					return nil, err
+				}
+
+				genreIDs, err := graphqlIntsArg(p, "genre_ids")
+				if err != nil {
+					return nil, err
+				}
+
+				stored, err := app.graphqlStoredMovie(p)
+				if err != nil {
+					return nil, err
+				}
+
+				v := newValidator()
+				validateGenreIDs(v, genreIDs)
+				if !v.Valid() {
+					return nil, graphqlValidationError(v.Errors)
+				}
+
+				movie := *stored
+				movie.UpdatedAt = time.Now()
+
+				store := graphqlStore(p.Context)
+				if err := store.UpdateMovie(movie, genreIDs); err != nil {
+					return nil, graphqlMovieError(err)
+				}
+				graphqlLoadersFrom(p.Context).movieChanged(movie.ID)
+
+				return store.Get(movie.ID)
+			},
+		},
+
+		"deleteMovie": &gql.Field{
+			Type:        gql.Boolean,
+			Description: "Move movie to trash",
+			Args: gql.FieldConfigArgument{
+				"id": &gql.ArgumentConfig{
+					Type: gql.NewNonNull(gql.Int),
+				},
+			},
+			Resolve: func(p gql.ResolveParams) (interface{}, error) {
+				if err := app.graphqlAuthorize(p.Context, models.PermMoviesWrite); err != nil {
+					return nil, err
+				}
+
+				id, err := graphqlIntArg(p, "id")
+				if err != nil {
+					return nil, err
+				}
+
+				if err := graphqlStore(p.Context).DeleteMovie(id); err != nil {
+					return nil, graphqlMovieError(err)
+				}
+				graphqlLoadersFrom(p.Context).movieChanged(id)
+
+				return true, nil
+			},
+		},
+	}
+}
+
+// graphqlAuthorize function checks that user authenticated by request of
+// ctx context has permission.
+func (app *application) graphqlAuthorize(ctx context.Context, permission string) error {
+	user, _ := ctx.Value(userContextKey).(*models.User)
+	if authErr := app.authorize(user, permission); authErr != nil {
+		return &graphqlError{code: authErr.code, message: authErr.message}
+	}
+
+	return nil
+}
+
+// graphqlMovieInput function converts value of input argument into
+// MovieInput, fields omitted in input stay nil.
+func graphqlMovieInput(arg interface{}) (MovieInput, error) {
+	var input MovieInput
+
+	data, err := json.Marshal(arg)
+	if err != nil {
+		return input, err
+	}
+
+	err = json.Unmarshal(data, &input)
+	return input, err
+}
+
+// graphqlIntArg function returns integer argument of name, or validation
+// error if it isn't an integer.
+func graphqlIntArg(p gql.ResolveParams, name string) (int, error) {
+	value, ok := p.Args[name].(int)
+	if !ok {
+		return 0, graphqlValidationError(map[string]string{name: "must be an integer"})
+	}
+
+	return value, nil
+}
+
+// graphqlIntsArg function returns integers of list argument of name, or
+// validation error if it isn't a list of integers.
+func graphqlIntsArg(p gql.ResolveParams, name string) ([]int, error) {
+	invalid := graphqlValidationError(map[string]string{name: "must be a list of integers"})
+
+	list, ok := p.Args[name].([]interface{})
+	if !ok {
+		return nil, invalid
+	}
+
+	values := make([]int, 0, len(list))
+	for _, item := range list {
+		value, ok := item.(int)
+		if !ok {
+			return nil, invalid
+		}
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+// graphqlStoredMovie function returns movie of id argument, checking that
+// it's still of version argument.
+func (app *application) graphqlStoredMovie(p gql.ResolveParams) (*models.Movie, error) {
+	id, err := graphqlIntArg(p, "id")
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := graphqlIntArg(p, "version")
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := graphqlStore(p.Context).Get(id)
+	if err != nil {
+		return nil, graphqlMovieError(err)
+	}
+
+	if version != stored.Version {
+		return nil, graphqlMovieError(models.ErrEditConflict)
+	}
+
+	return stored, nil
+}
+
+// graphqlMovieError function converts error of movie read or write into
+// GraphQL error, as movieWriteError does for REST APIs.
+func graphqlMovieError(err error) error {
+	switch {
+	case errors.Is(err, models.ErrUnknownGenre):
+		return graphqlValidationError(map[string]string{
+			"genre_ids": strings.TrimPrefix(err.Error(), "models: "),
+		})
+	case errors.Is(err, models.ErrNoRecord):
+		return &graphqlError{code: "not_found", message: "movie not found"}
+	case errors.Is(err, models.ErrEditConflict):
+		return &graphqlError{
+			code:    "edit_conflict",
+			message: "movie was changed by someone else, merge your changes with the current movie",
+		}
+	default:
+		return err
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"backend/models"
+	"net/http"
+	"testing"
+)
+
+func TestGraphQLMutations(t *testing.T) {
+	ta := newTestApp(t)
+
+	const alien = `{title: "Alien", release_date: "1979-05-25", runtime: 117, rating: 5, mpaa_rating: "R", genre_ids: [9]}`
+
+	ta.runGraphQLTests(t, []graphqlTest{
+		{
+			name:  "mutation without token",
+			query: `mutation { deleteMovie(id: 3) }`,
+			code:  ErrCodeMissingToken,
+		},
+		{
+			name:  "mutation of viewer",
+			role:  models.RoleViewer,
+			query: `mutation { deleteMovie(id: 3) }`,
+			code:  ErrCodeNotEnoughRights,
+		},
+		{
+			name:  "create invalid movie",
+			role:  models.RoleEditor,
+			query: `mutation { createMovie(input: {title: " ", rating: 10}) { id } }`,
+			code:  "validation_failed",
+		},
+		{
+			name:  "create",
+			role:  models.RoleEditor,
+			query: `mutation { createMovie(input: ` + alien + `) { id title year version } }`,
+			data:  `{"createMovie":{"id":11,"title":"Alien","version":1,"year":1979}}`,
+		},
+		{
+			name:  "update of stale version",
+			role:  models.RoleEditor,
+			query: `mutation { updateMovie(id: 11, version: 7, input: {rating: 4}) { id } }`,
+			code:  "edit_conflict",
+		},
+		{
+			name:  "update of unknown movie",
+			role:  models.RoleEditor,
+			query: `mutation { updateMovie(id: 999, version: 1, input: {rating: 4}) { id } }`,
+			code:  "not_found",
+		},
+		{
+			name:  "updates see previous ones",
+			role:  models.RoleEditor,
+			query: `mutation { a: updateMovie(id: 11, version: 1, input: {rating: 4}) { version } b: updateMovie(id: 11, version: 2, input: {runtime: 116}) { version rating runtime } }`,
+			data:  `{"a":{"version":2},"b":{"rating":4,"runtime":116,"version":3}}`,
+		},
+		{
+			name:  "set unknown genre",
+			role:  models.RoleEditor,
+			query: `mutation { setMovieGenres(id: 11, version: 3, genre_ids: [999]) { id } }`,
+			code:  "validation_failed",
+		},
+		{
+			name:  "set genres",
+			role:  models.RoleEditor,
+			query: `mutation { setMovieGenres(id: 11, version: 3, genre_ids: [9, 10]) { version genres { genre_name } } }`,
+			data:  `{"setMovieGenres":{"genres":[{"genre_name":"Sci-Fi"},{"genre_name":"Thriller"}],"version":4}}`,
+		},
+		{
+			name:  "delete",
+			role:  models.RoleEditor,
+			query: `mutation { deleteMovie(id: 11) }`,
+			data:  `{"deleteMovie":true}`,
+		},
+		{
+			name:  "delete deleted movie",
+			role:  models.RoleEditor,
+			query: `mutation { deleteMovie(id: 11) }`,
+			code:  "not_found",
+		},
+	})
+
+	// Invalid input fields are reported as REST validation errors are
+	result := ta.graphql(t, models.RoleEditor, `mutation { createMovie(input: {title: "Alien", rating: 10, mpaa_rating: "X"}) { id } }`, nil)
+	if len(result.Errors) == 0 {
+		t.Fatalf("no errors, data %s", result.Data)
+	}
+	fields, _ := result.Errors[0].Extensions["fields"].(map[string]interface{})
+	for _, field := range []string{"release_date", "runtime", "rating", "mpaa_rating"} {
+		if _, ok := fields[field]; !ok {
+			t.Errorf("no error of %s, errors %+v", field, result.Errors)
+		}
+	}
+
+	res := ta.request(t, http.MethodGet, "/v1/movies/11", "", "", nil)
+	checkResponse(t, res, http.StatusNotFound, "")
+}
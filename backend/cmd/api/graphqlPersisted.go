@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	gql "github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// persistedQueryExtension is a type of persistedQuery request extension of
+// Apollo automatic persisted queries protocol.
+type persistedQueryExtension struct {
+	Version    int    `json:"version"`
+	SHA256Hash string `json:"sha256Hash"`
+}
+
+// loadPersistedQueries function reads JSON file of persisted queries, an
+// object of queries by lowercase hex SHA-256 hashes of their text. Every
+// query must match its hash and be valid against the schema.
+func (app *application) loadPersistedQueries(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var queries map[string]string
+	if err := json.Unmarshal(data, &queries); err != nil {
+		return nil, fmt.Errorf("invalid persisted queries file %s: %+v", path, err)
+	}
+
+	persisted := make(map[string]string, len(queries))
+	for hash, query := range queries {
+		hash = strings.ToLower(hash)
+		if queryHash(query) != hash {
+			return nil, fmt.Errorf("persisted query %s doesn't match its SHA-256 hash", hash)
+		}
+
+		doc, err := parser.Parse(parser.ParseParams{
+			Source: source.NewSource(&source.Source{Body: []byte(query), Name: "GraphQL request"}),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid persisted query %s: %+v", hash, err)
+		}
+
+		if validation := gql.ValidateDocument(&app.graphql, doc, nil); !validation.IsValid {
+			return nil, fmt.Errorf("invalid persisted query %s: %+v", hash, validation.Errors)
+		}
+
+		persisted[hash] = query
+	}
+
+	app.logger.Printf("Loaded %d persisted GraphQL queries", len(persisted))
+
+	return persisted, nil
+}
+
+// queryHash function returns lowercase hex SHA-256 hash of query.
+func queryHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// persistedQuery function sets query of request by its persisted query
+// hash, or checks that query matches the hash. If only persisted queries
+// are allowed, rejects requests of other queries.
+func (app *application) persistedQuery(req *graphqlRequest) error {
+	var hash string
+	if req.Extensions.PersistedQuery != nil {
+		hash = strings.ToLower(req.Extensions.PersistedQuery.SHA256Hash)
+	}
+
+	if hash == "" {
+		if app.config.graphql.persistedOnly {
+			return &graphqlRequestError{
+				status:  http.StatusBadRequest,
+				code:    "persisted_query_required",
+				message: "only persisted queries are allowed, send sha256Hash of query in persistedQuery extension",
+			}
+		}
+		return nil
+	}
+
+	stored, ok := app.persistedQueries[hash]
+
+	if req.Query == "" {
+		if !ok {
+			// Code and message of the protocol, so clients may retry
+			// with query text
+			return &graphqlRequestError{
+				status:  http.StatusOK,
+				code:    "PERSISTED_QUERY_NOT_FOUND",
+				message: "PersistedQueryNotFound",
+			}
+		}
+
+		req.Query = stored
+		return nil
+	}
+
+	if queryHash(req.Query) != hash {
+		return &graphqlRequestError{
+			status:  http.StatusBadRequest,
+			code:    "persisted_query_mismatch",
+			message: "provided sha256Hash doesn't match query",
+		}
+	}
+
+	if !ok && app.config.graphql.persistedOnly {
+		return &graphqlRequestError{
+			status:  http.StatusBadRequest,
+			code:    "persisted_query_not_allowed",
+			message: "query is not persisted, only persisted queries are allowed",
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGraphQLPersistedQueries(t *testing.T) {
+	ta := newTestApp(t)
+
+	const persisted = `query Movie($id: Int!) { movie(id: $id) { title } }`
+	const other = `{ movie(id: 1) { title } }`
+
+	ta.app.persistedQueries = map[string]string{queryHash(persisted): persisted}
+
+	// persistedBody function returns JSON body of request of query with
+	// persistedQuery extension of hash.
+	persistedBody := func(query, hash string) string {
+		return jsonBody(graphqlRequest{
+			Query:      query,
+			Variables:  map[string]interface{}{"id": 5},
+			Extensions: graphqlExtensions{PersistedQuery: &persistedQueryExtension{Version: 1, SHA256Hash: hash}},
+		})
+	}
+
+	tests := []struct {
+		name          string
+		persistedOnly bool
+		method        string
+		path          string
+		body          string
+		status        int
+		// Expected error code, empty if no errors are expected
+		code string
+	}{
+		{
+			name:   "persisted query by hash",
+			method: http.MethodPost,
+			body:   persistedBody("", queryHash(persisted)),
+			status: http.StatusOK,
+		},
+		{
+			name:   "persisted query by GET",
+			method: http.MethodGet,
+			path: "?variables=" + url.QueryEscape(`{"id":5}`) +
+				"&extensions=" + url.QueryEscape(`{"persistedQuery":{"version":1,"sha256Hash":"`+queryHash(persisted)+`"}}`),
+			status: http.StatusOK,
+		},
+		{
+			name:   "unknown hash",
+			method: http.MethodPost,
+			body:   persistedBody("", queryHash(other)),
+			status: http.StatusOK,
+			code:   "PERSISTED_QUERY_NOT_FOUND",
+		},
+		{
+			name:   "query of another hash",
+			method: http.MethodPost,
+			body:   persistedBody(other, queryHash(persisted)),
+			status: http.StatusBadRequest,
+			code:   "persisted_query_mismatch",
+		},
+		{
+			name:   "query with its hash",
+			method: http.MethodPost,
+			body:   persistedBody(other, queryHash(other)),
+			status: http.StatusOK,
+		},
+		{
+			name:          "only persisted queries",
+			persistedOnly: true,
+			method:        http.MethodPost,
+			body:          persistedBody("", queryHash(persisted)),
+			status:        http.StatusOK,
+		},
+		{
+			name:          "only persisted queries without hash",
+			persistedOnly: true,
+			method:        http.MethodPost,
+			body:          jsonBody(graphqlRequest{Query: other}),
+			status:        http.StatusBadRequest,
+			code:          "persisted_query_required",
+		},
+		{
+			name:          "only persisted queries with query not persisted",
+			persistedOnly: true,
+			method:        http.MethodPost,
+			body:          persistedBody(other, queryHash(other)),
+			status:        http.StatusBadRequest,
+			code:          "persisted_query_not_allowed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ta.app.config.graphql.persistedOnly = tt.persistedOnly
+
+			res := ta.request(t, tt.method, "/v1/graphql"+tt.path, "", tt.body, nil)
+			if res.Code != tt.status {
+				t.Fatalf("status %d, expected %d, body %s", res.Code, tt.status, res.Body)
+			}
+
+			var result graphqlResult
+			decodeBody(t, res, &result)
+
+			if tt.code == "" {
+				if len(result.Errors) > 0 {
+					t.Fatalf("errors %+v", result.Errors)
+				}
+				return
+			}
+
+			if len(result.Errors) == 0 {
+				t.Fatalf("no errors, expected %s, data %s", tt.code, result.Data)
+			}
+			if code := result.Errors[0].Extensions["code"]; code != tt.code {
+				t.Errorf("error code %v, expected %s, errors %+v", code, tt.code, result.Errors)
+			}
+		})
+	}
+}
+
+func TestLoadPersistedQueries(t *testing.T) {
+	ta := newTestApp(t)
+
+	const query = `{ movie(id: 1) { title } }`
+
+	tests := []struct {
+		name    string
+		queries map[string]string
+		valid   bool
+	}{
+		{"valid", map[string]string{queryHash(query): query}, true},
+		{"hash of another query", map[string]string{queryHash(query): "{ genres { genre_name } }"}, false},
+		{"query invalid against schema", map[string]string{queryHash("{ budget }"): "{ budget }"}, false},
+		{"malformed query", map[string]string{queryHash("{ movie"): "{ movie"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "queries.json")
+			if err := os.WriteFile(path, []byte(jsonBody(tt.queries)), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			queries, err := ta.app.loadPersistedQueries(path)
+			if tt.valid {
+				if err != nil || queries[queryHash(query)] != query {
+					t.Errorf("queries %v, error %v", queries, err)
+				}
+			} else if err == nil {
+				t.Error("no error")
+			}
+		})
+	}
+}
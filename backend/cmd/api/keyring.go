@@ -0,0 +1,262 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+// keyring type holds JWT signing and verification keys. Asymmetric keys are
+// PEM-encoded private keys (RSA or Ed25519) read from keys directory, file
+// name without extension is the key ID (kid). All of them are accepted on
+// verification, only one key signs new tokens: the one named in
+// SIGNING_KID_FILE of keys directory, if present, otherwise the configured
+// one, or the only key in directory. HMAC secret, if set, is used for
+// signing and verification when no keys directory is configured. With keys
+// directory HMAC tokens are accepted only until configured cutoff time, so
+// tokens issued before switching to asymmetric keys stay valid until they
+// expire, but whoever holds the secret can't mint tokens after that. Every
+// accepted HMAC token is logged then.
+//
+// Key rotation without downtime:
+//  1. put a new key file into keys directory and reload keys (SIGHUP), so
+//     the new public key is published by JWKS endpoint;
+//  2. once other services have refreshed JWKS, write the new key ID into
+//     SIGNING_KID_FILE and reload keys again;
+//  3. remove the old key file when all tokens signed by it are expired.
+type keyring struct {
+	dir        string
+	signingKID string
+	secret     []byte
+	// HMAC tokens are accepted until this time if keys directory is set,
+	// zero time rejects them
+	hmacUntil time.Time
+	logger    *log.Logger
+
+	mu       sync.RWMutex
+	register *jwt.KeyRegister
+	// HMAC secret of tokens issued before keys directory was configured
+	legacy *jwt.KeyRegister
+	signer interface{}
+	kid    string
+	jwks   []byte
+}
+
+// SIGNING_KID_FILE is a name of file in keys directory holding ID of the
+// key signing new tokens
+const SIGNING_KID_FILE = "signing_kid"
+
+// jsonWebKey type describes public key in JWK format (RFC 7517)
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// newKeyring function returns keyring with keys loaded from dir, signing
+// new tokens with signingKID key. If dir is empty, only HMAC secret is used,
+// otherwise HMAC tokens are accepted until hmacUntil.
+func newKeyring(dir, signingKID string, secret []byte, hmacUntil time.Time, logger *log.Logger) (*keyring, error) {
+	k := &keyring{
+		dir:        dir,
+		signingKID: signingKID,
+		secret:     secret,
+		hmacUntil:  hmacUntil,
+		logger:     logger,
+	}
+
+	if err := k.load(); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// load function (re)reads all keys from keys directory. Current keys stay
+// in use if any of key files is invalid.
+func (k *keyring) load() error {
+	register := &jwt.KeyRegister{}
+	var legacy *jwt.KeyRegister
+	if len(k.secret) > 0 {
+		if k.dir == "" {
+			register.Secrets = [][]byte{k.secret}
+		} else if !k.hmacUntil.IsZero() {
+			legacy = &jwt.KeyRegister{Secrets: [][]byte{k.secret}}
+		}
+	}
+
+	var signer interface{}
+	var kid string
+	var webKeys []jsonWebKey
+
+	if k.dir != "" {
+		files, err := filepath.Glob(filepath.Join(k.dir, "*.pem"))
+		if err != nil {
+			return err
+		}
+		sort.Strings(files)
+
+		signingKID := k.signingKID
+		if b, err := os.ReadFile(filepath.Join(k.dir, SIGNING_KID_FILE)); err == nil {
+			signingKID = strings.TrimSpace(string(b))
+		}
+
+		for _, file := range files {
+			id := strings.TrimSuffix(filepath.Base(file), ".pem")
+
+			key, err := readPrivateKey(file)
+			if err != nil {
+				return fmt.Errorf("invalid JWT key %s: %+v", file, err)
+			}
+
+			switch key := key.(type) {
+			case *rsa.PrivateKey:
+				register.RSAs = append(register.RSAs, &key.PublicKey)
+				register.RSAIDs = append(register.RSAIDs, id)
+				webKeys = append(webKeys, jsonWebKey{
+					Kty: "RSA",
+					Kid: id,
+					Use: "sig",
+					Alg: jwt.RS256,
+					N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+					E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+				})
+			case ed25519.PrivateKey:
+				register.EdDSAs = append(register.EdDSAs, key.Public().(ed25519.PublicKey))
+				register.EdDSAIDs = append(register.EdDSAIDs, id)
+				webKeys = append(webKeys, jsonWebKey{
+					Kty: "OKP",
+					Kid: id,
+					Use: "sig",
+					Alg: jwt.EdDSA,
+					Crv: "Ed25519",
+					X:   base64.RawURLEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+				})
+			default:
+				return fmt.Errorf("invalid JWT key %s: unsupported key type %T", file, key)
+			}
+
+			// The only key is the signing one, if not configured explicitly
+			if id == signingKID || (signingKID == "" && len(files) == 1) {
+				signer, kid = key, id
+			}
+		}
+
+		if signer == nil {
+			return fmt.Errorf("JWT signing key %q not found in %s", signingKID, k.dir)
+		}
+	} else if len(k.secret) == 0 {
+		return errors.New("neither JWT keys directory nor JWT secret configured")
+	}
+
+	if webKeys == nil {
+		webKeys = []jsonWebKey{}
+	}
+	jwks, err := json.Marshal(map[string]interface{}{"keys": webKeys})
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.register = register
+	k.legacy = legacy
+	k.signer = signer
+	k.kid = kid
+	k.jwks = jwks
+
+	return nil
+}
+
+// sign function signs claims by the current signing key, or by HMAC secret
+// if no asymmetric keys configured.
+func (k *keyring) sign(claims *jwt.Claims) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	switch key := k.signer.(type) {
+	case *rsa.PrivateKey:
+		claims.KeyID = k.kid
+		return claims.RSASign(jwt.RS256, key)
+	case ed25519.PrivateKey:
+		claims.KeyID = k.kid
+		return claims.EdDSASign(key)
+	default:
+		return claims.HMACSign(jwt.HS256, k.secret)
+	}
+}
+
+// check function parses token if its signature matches any of known keys,
+// or HMAC secret before HMAC cutoff time.
+func (k *keyring) check(token []byte) (*jwt.Claims, error) {
+	k.mu.RLock()
+	register, legacy := k.register, k.legacy
+	k.mu.RUnlock()
+
+	claims, err := register.Check(token)
+	if err == nil || legacy == nil || time.Now().After(k.hmacUntil) {
+		return claims, err
+	}
+
+	claims, hmacErr := legacy.Check(token)
+	if hmacErr != nil {
+		return nil, err
+	}
+
+	k.logger.Printf("Accepted JWT %s of user %s signed with HMAC secret, HMAC tokens are accepted until %s",
+		claims.ID, claims.Subject, k.hmacUntil.Format(time.RFC3339))
+
+	return claims, nil
+}
+
+// publicJWKS function returns JSON Web Key Set of all public keys.
+func (k *keyring) publicJWKS() []byte {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.jwks
+}
+
+// readPrivateKey function reads PEM-encoded private key in PKCS #8 or
+// PKCS #1 (RSA only) format.
+func readPrivateKey(file string) (interface{}, error) {
+	text, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(text)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM type %q", block.Type)
+	}
+}
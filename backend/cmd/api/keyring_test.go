@@ -0,0 +1,252 @@
+package main
+
+import (
+	"backend/models"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+// writeKey function writes a new private key of type (rsa or ed25519) into
+// dir as kid key.
+func writeKey(t *testing.T, dir, kid, typ string) {
+	t.Helper()
+
+	var key interface{}
+	var err error
+	switch typ {
+	case "rsa":
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), text, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// signTest function signs claims of test token by keyring.
+func signTest(t *testing.T, k *keyring) []byte {
+	t.Helper()
+
+	var claims jwt.Claims
+	claims.Subject = "1"
+	claims.ID = "test"
+
+	token, err := k.sign(&claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+// jwksKIDs function returns IDs of keys published by keyring.
+func jwksKIDs(t *testing.T, k *keyring) []string {
+	t.Helper()
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(k.publicJWKS(), &jwks); err != nil {
+		t.Fatal(err)
+	}
+
+	kids := []string{}
+	for _, key := range jwks.Keys {
+		kids = append(kids, key.Kid)
+	}
+
+	return kids
+}
+
+func TestKeyringRotation(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "k1", "ed25519")
+
+	k, err := newKeyring(dir, "k1", nil, time.Time{}, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := signTest(t, k)
+
+	steps := []struct {
+		name   string
+		change func()
+		kids   []string
+		// Whether reloading of keys fails
+		invalid bool
+		// ID of the signing key
+		signer string
+		// Whether token signed before rotation is accepted
+		old bool
+	}{
+		{
+			name:   "new key is published",
+			change: func() { writeKey(t, dir, "k2", "rsa") },
+			kids:   []string{"k1", "k2"},
+			signer: "k1",
+			old:    true,
+		},
+		{
+			name: "new key signs",
+			change: func() {
+				if err := os.WriteFile(filepath.Join(dir, SIGNING_KID_FILE), []byte("k2\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			kids:   []string{"k1", "k2"},
+			signer: "k2",
+			old:    true,
+		},
+		{
+			name: "invalid key file keeps current keys",
+			change: func() {
+				if err := os.WriteFile(filepath.Join(dir, "k3.pem"), []byte("invalid"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			invalid: true,
+			kids:    []string{"k1", "k2"},
+			signer:  "k2",
+			old:     true,
+		},
+		{
+			name: "old key is removed",
+			change: func() {
+				for _, name := range []string{"k1.pem", "k3.pem"} {
+					if err := os.Remove(filepath.Join(dir, name)); err != nil {
+						t.Fatal(err)
+					}
+				}
+			},
+			kids:   []string{"k2"},
+			signer: "k2",
+			old:    false,
+		},
+	}
+
+	for _, step := range steps {
+		step.change()
+		if err := k.load(); (err != nil) != step.invalid {
+			t.Fatalf("%s: load error %v", step.name, err)
+		}
+
+		if kids := jwksKIDs(t, k); !equalStrings(kids, step.kids) {
+			t.Fatalf("%s: JWKS keys %q, expected %q", step.name, kids, step.kids)
+		}
+
+		claims, err := k.check(signTest(t, k))
+		if err != nil {
+			t.Fatalf("%s: new token rejected: %v", step.name, err)
+		}
+		if claims.KeyID != step.signer {
+			t.Fatalf("%s: token signed by %s, expected %s", step.name, claims.KeyID, step.signer)
+		}
+
+		if _, err := k.check(old); (err == nil) != step.old {
+			t.Fatalf("%s: token signed before rotation accepted %t, expected %t", step.name, err == nil, step.old)
+		}
+	}
+}
+
+func TestKeyringHMACCutoff(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "k1", "ed25519")
+
+	secret := []byte("test-secret")
+	logger := log.New(io.Discard, "", 0)
+
+	hmac, err := newKeyring("", "", secret, time.Time{}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := signTest(t, hmac)
+
+	tests := []struct {
+		name      string
+		hmacUntil time.Time
+		accepted  bool
+	}{
+		{"no cutoff", time.Time{}, false},
+		{"before cutoff", time.Now().Add(time.Hour), true},
+		{"after cutoff", time.Now().Add(-time.Hour), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := newKeyring(dir, "", secret, tt.hmacUntil, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := k.check(token); (err == nil) != tt.accepted {
+				t.Errorf("HMAC token accepted %t, expected %t", err == nil, tt.accepted)
+			}
+
+			// Secret doesn't sign new tokens once keys are configured
+			claims, err := k.check(signTest(t, k))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.KeyID != "k1" {
+				t.Errorf("new token of key %q, expected k1", claims.KeyID)
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	ta := newTestApp(t)
+
+	dir := t.TempDir()
+	writeKey(t, dir, "k1", "rsa")
+
+	keys, err := newKeyring(dir, "", nil, time.Time{}, ta.app.logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ta.app.keys = keys
+
+	res := ta.request(t, http.MethodGet, "/.well-known/jwks.json", "", "", nil)
+	checkResponse(t, res, http.StatusOK, "")
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	decodeBody(t, res, &jwks)
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != "k1" || jwks.Keys[0].Alg != jwt.RS256 || jwks.Keys[0].N == "" {
+		t.Fatalf("JWKS %+v, expected RSA key k1", jwks.Keys)
+	}
+
+	// Tokens signed by the secret before keys are configured are rejected
+	res = ta.request(t, http.MethodGet, "/v1/movies/1/revisions", models.RoleEditor, "", nil)
+	checkResponse(t, res, http.StatusUnauthorized, ErrCodeInvalidSignature)
+
+	tokens := ta.signinTokens(t, "editor@test.local", testPassword)
+	res = ta.request(t, http.MethodGet, "/v1/movies/1/revisions", "", "", bearer(tokens.Response))
+	checkResponse(t, res, http.StatusOK, "")
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"backend/mailer"
 	"backend/models"
 	"context"
 	"database/sql"
@@ -9,8 +10,11 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	gql "github.com/graphql-go/graphql"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
@@ -24,6 +28,14 @@ type application struct {
 	config config
 	logger *log.Logger
 	models models.Models
+	mailer mailer.Mailer
+	keys   *keyring
+	// Database connection pool, nil for in-memory store
+	db *sql.DB
+	// GraphQL schema, built once on start
+	graphql gql.Schema
+	// Persisted GraphQL queries by SHA-256 hashes of their text
+	persistedQueries map[string]string
 }
 
 func main() {
@@ -44,30 +56,119 @@ func main() {
 		logger.Fatal("Error loading .env file")
 	}
 
+	// Command goes first, before flags: "api [command] [flags] [args]"
+	command := readCommand()
+
 	// Take all flags into our config
 	cfg.readAllFlags()
 
-	// Open a new database connection
-	db, err := openDB(cfg)
+	// Select models store: PostgreSQL database or in-memory one
+	var appModels models.Models
+	var appDB *sql.DB
+	switch cfg.store {
+	case "postgres":
+		// Open a new database connection
+		db, err := openDB(cfg)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+
+		appDB = db
+		appModels = models.NewModels(db)
+	case "memory":
+		logger.Println("Using in-memory store, all data will be lost on exit")
+		appModels = models.NewMemoryModels()
+	default:
+		logger.Fatalf("Unknown store type: %s", cfg.store)
+	}
+
+	// Select mailer: SMTP server or log (and files) for development
+	var appMailer mailer.Mailer
+	switch cfg.mailer.kind {
+	case "smtp":
+		appMailer = mailer.NewSMTP(
+			cfg.mailer.smtp.host,
+			cfg.mailer.smtp.port,
+			cfg.mailer.smtp.username,
+			cfg.mailer.smtp.password,
+			cfg.mailer.sender,
+		)
+	case "log":
+		appMailer = mailer.NewLog(logger, cfg.mailer.dir, cfg.mailer.sender)
+	default:
+		logger.Fatalf("Unknown mailer type: %s", cfg.mailer.kind)
+	}
+
+	// JWT signing and verification keys
+	var hmacUntil time.Time
+	if cfg.jwt.hmacUntil != "" {
+		hmacUntil, err = time.Parse(time.RFC3339, cfg.jwt.hmacUntil)
+		if err != nil {
+			logger.Fatalf("Invalid JWT HMAC cutoff time, RFC 3339 expected: %+v", err)
+		}
+	}
+	keys, err := newKeyring(cfg.jwt.keysDir, cfg.jwt.signingKey, []byte(cfg.jwt.secret), hmacUntil, logger)
 	if err != nil {
 		logger.Fatal(err)
 	}
-	defer db.Close()
 
 	// Creating a new application receiver instance
 	// [application] type becomes a receiver for lots of other modules & packages
 	app := &application{
 		config: cfg,
 		logger: logger,
-		models: models.NewModels(db),
+		models: appModels,
+		mailer: appMailer,
+		keys:   keys,
+		db:     appDB,
+	}
+
+	// GraphQL resolvers get store of every request from its context
+	app.graphql, err = app.graphqlSchema()
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	if cfg.graphql.persistedQueries != "" {
+		app.persistedQueries, err = app.loadPersistedQueries(cfg.graphql.persistedQueries)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	} else if cfg.graphql.persistedOnly {
+		logger.Fatal("GraphQL persisted queries file is required to allow only persisted queries")
 	}
 
+	// Run the requested command, HTTP server is the default one
+	switch command {
+	case "serve":
+		err = app.serve()
+	case "import-users":
+		err = app.importUsers(flag.Args()...)
+	case "set-role":
+		err = app.setRole(flag.Arg(0), flag.Arg(1))
+	case "migrate":
+		err = app.migrate(flag.Arg(0), flag.Arg(1))
+	case "seed":
+		err = app.seed(flag.Args()...)
+	default:
+		err = fmt.Errorf("unknown command: %s", command)
+	}
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+}
+
+// serve function starts HTTP server of the application and blocks until
+// it's stopped.
+func (app *application) serve() error {
 	// HTTP server configuration
 	var addr string
 	if os.Getenv("APP_ENV") == "development" {
-		addr = fmt.Sprintf("localhost:%d", cfg.port)
+		addr = fmt.Sprintf("localhost:%d", app.config.port)
 	} else {
-		addr = fmt.Sprintf(":%d", cfg.port)
+		addr = fmt.Sprintf(":%d", app.config.port)
 	}
 	srv := &http.Server{
 		Addr:         addr,
@@ -77,13 +178,35 @@ func main() {
 		WriteTimeout: 30 * time.Second,
 	}
 
-	logger.Println("Starting server on port", cfg.port)
+	// Pending migrations may be applied on startup, so deploy is a single step
+	if app.config.db.migrate && app.db != nil {
+		if err := app.migrate("up", ""); err != nil {
+			return err
+		}
+	}
 
-	// Starting a new HTTP server listener ...
-	if err := srv.ListenAndServe(); err != nil {
-		logger.Println(err)
+	// Sample dataset may be loaded on startup, e.g. into in-memory store
+	if app.config.seed {
+		if err := app.seed(); err != nil {
+			return err
+		}
 	}
 
+	// JWT keys are reloaded on SIGHUP, so they may be rotated without restart
+	app.reloadKeysOnSignal()
+
+	// Expired tokens are of no use, so they are purged periodically
+	app.runPeriodically(time.Hour, "purge expired tokens", app.models.DB.PurgeExpiredTokens)
+
+	// Movies are restorable from trash only within retention
+	if app.config.trashRetention > 0 {
+		app.runPeriodically(time.Hour, "purge trash", app.purgeTrash)
+	}
+
+	app.logger.Println("Starting server on port", app.config.port)
+
+	// Starting a new HTTP server listener ...
+	return srv.ListenAndServe()
 }
 
 // This function makes a new DB context and PostgreSQL driver connection
@@ -122,6 +245,13 @@ func (cfg *config) readAllFlags() {
 		"Application environment (development|production)",
 	)
 
+	flag.StringVar(
+		&cfg.store,
+		"store",
+		lookupEnv("STORE", "postgres"),
+		"Models store type (postgres|memory)",
+	)
+
 	flag.StringVar(
 		&cfg.db.dsn,
 		"dsn",
@@ -129,6 +259,55 @@ func (cfg *config) readAllFlags() {
 		"PostgreSQL connection string",
 	)
 
+	flag.BoolVar(
+		&cfg.db.migrate,
+		"db-migrate",
+		lookupEnvBool("DB_MIGRATE", false),
+		"Apply pending database migrations on server startup",
+	)
+
+	flag.BoolVar(
+		&cfg.seed,
+		"seed",
+		lookupEnvBool("SEED", false),
+		"Load sample movies dataset into the store on server startup",
+	)
+
+	flag.DurationVar(
+		&cfg.trashRetention,
+		"trash-retention",
+		lookupEnvDuration("TRASH_RETENTION", 30*24*time.Hour),
+		"Time deleted movies are kept in trash before purge, 0 keeps them forever",
+	)
+
+	flag.IntVar(
+		&cfg.graphql.maxDepth,
+		"graphql-max-depth",
+		lookupEnvInt("GRAPHQL_MAX_DEPTH", 15),
+		"Maximum depth of GraphQL query fields, 0 disables the limit",
+	)
+
+	flag.IntVar(
+		&cfg.graphql.maxComplexity,
+		"graphql-max-complexity",
+		lookupEnvInt("GRAPHQL_MAX_COMPLEXITY", 20000),
+		"Maximum complexity of GraphQL query, 0 disables the limit",
+	)
+
+	flag.StringVar(
+		&cfg.graphql.persistedQueries,
+		"graphql-persisted-queries",
+		lookupEnv("GRAPHQL_PERSISTED_QUERIES", ""),
+		"JSON file of persisted GraphQL queries by their SHA-256 hashes",
+	)
+
+	flag.BoolVar(
+		&cfg.graphql.persistedOnly,
+		"graphql-persisted-only",
+		lookupEnvBool("GRAPHQL_PERSISTED_ONLY", false),
+		"Allow only persisted GraphQL queries",
+	)
+
 	flag.StringVar(
 		&cfg.jwt.audiences,
 		"jwt-aud",
@@ -150,5 +329,136 @@ func (cfg *config) readAllFlags() {
 		"JWT secret",
 	)
 
+	flag.StringVar(
+		&cfg.jwt.keysDir,
+		"jwt-keys-dir",
+		lookupEnv("JWT_KEYS_DIR", ""),
+		"Directory of PEM-encoded JWT private keys (RSA or Ed25519), named <kid>.pem",
+	)
+
+	flag.StringVar(
+		&cfg.jwt.signingKey,
+		"jwt-signing-kid",
+		lookupEnv("JWT_SIGNING_KID", ""),
+		"ID of JWT key signing new tokens",
+	)
+
+	flag.StringVar(
+		&cfg.jwt.hmacUntil,
+		"jwt-hmac-until",
+		lookupEnv("JWT_HMAC_UNTIL", ""),
+		"RFC 3339 time until which tokens signed with JWT secret are accepted along with keys of keys directory",
+	)
+
+	flag.DurationVar(
+		&cfg.jwt.ttl,
+		"jwt-ttl",
+		lookupEnvDuration("JWT_TTL", 15*time.Minute),
+		"Lifetime of access token",
+	)
+
+	flag.DurationVar(
+		&cfg.jwt.refreshTTL,
+		"jwt-refresh-ttl",
+		lookupEnvDuration("JWT_REFRESH_TTL", 30*24*time.Hour),
+		"Lifetime of refresh token",
+	)
+
+	flag.DurationVar(
+		&cfg.jwt.leeway,
+		"jwt-leeway",
+		lookupEnvDuration("JWT_LEEWAY", 30*time.Second),
+		"Allowed clock skew on token expiry and not-before checks",
+	)
+
+	flag.StringVar(
+		&cfg.mailer.kind,
+		"mailer",
+		lookupEnv("MAILER", "log"),
+		"Mailer type (smtp|log)",
+	)
+
+	flag.StringVar(
+		&cfg.mailer.dir,
+		"mailer-dir",
+		lookupEnv("MAILER_DIR", ""),
+		"Directory to write messages into by log mailer",
+	)
+
+	flag.StringVar(
+		&cfg.mailer.sender,
+		"mailer-sender",
+		lookupEnv("MAILER_SENDER", "Go Movies <no-reply@example.com>"),
+		"Sender of email messages",
+	)
+
+	flag.StringVar(
+		&cfg.mailer.smtp.host,
+		"smtp-host",
+		lookupEnv("SMTP_HOST", "localhost"),
+		"SMTP server host",
+	)
+
+	flag.IntVar(
+		&cfg.mailer.smtp.port,
+		"smtp-port",
+		lookupEnvInt("SMTP_PORT", 25),
+		"SMTP server port",
+	)
+
+	flag.StringVar(
+		&cfg.mailer.smtp.username,
+		"smtp-username",
+		lookupEnv("SMTP_USERNAME", ""),
+		"SMTP server username",
+	)
+
+	flag.StringVar(
+		&cfg.mailer.smtp.password,
+		"smtp-password",
+		lookupEnv("SMTP_PASSWORD", ""),
+		"SMTP server password",
+	)
+
+	flag.StringVar(
+		&cfg.appURL,
+		"app-url",
+		lookupEnv("APP_URL", "http://localhost:3000"),
+		"Base URL of frontend app, used for links in emails",
+	)
+
 	flag.Parse()
 }
+
+// reloadKeysOnSignal function reloads JWT keys from keys directory every
+// time the process receives SIGHUP.
+func (app *application) reloadKeysOnSignal() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	app.background(func() {
+		for range hup {
+			if err := app.keys.load(); err != nil {
+				app.logger.Println(fmt.Errorf("failed to reload JWT keys: %+v", err))
+				continue
+			}
+			app.logger.Println("JWT keys reloaded")
+		}
+	})
+}
+
+// purgeTrash function permanently deletes movies kept in trash longer than
+// trash retention, deletes are audited on behalf of system actor.
+func (app *application) purgeTrash() error {
+	store := app.models.DB.WithActor(models.SystemActor("purge-trash"))
+	n, err := store.PurgeDeletedMovies(time.Now().Add(-app.config.trashRetention))
+	if err != nil {
+		return err
+	}
+
+	if n > 0 {
+		app.logger.Printf("Purged %d movies from trash", n)
+	}
+
+	return nil
+}
@@ -2,23 +2,20 @@ package main
 
 import (
 	"context"
-	"errors"
 	"net/http"
-	"strconv"
 	"strings"
-	"time"
 
 	"github.com/julienschmidt/httprouter"
-	"github.com/pascaldekloe/jwt"
 )
 
 // wrap middleware makes a chain with underlying http handler, providing
-// httprouter request params into context. It may contain single or multiple
+// httprouter request params into context, so handlers may read them by
+// httprouter.ParamsFromContext. It may contain single or multiple
 // chaining http handlers controled by alice library
 // (see https://github.com/justinas/alice#usage)
 func (app *application) wrap(next http.Handler) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		ctx := context.WithValue(r.Context(), "params", ps)
+		ctx := context.WithValue(r.Context(), httprouter.ParamsKey, ps)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
@@ -29,81 +26,96 @@ func (app *application) wrap(next http.Handler) httprouter.Handle {
 func (app *application) enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type,Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type,Authorization,If-Match")
+		w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE,OPTIONS")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag,Location,X-Request-ID")
 
 		next.ServeHTTP(w, r)
 	})
 }
 
+// requestID middleware function identifies every request by ID from
+// X-Request-ID header, if it's sane, or by a new random one. The ID is sent
+// back in the same response header, so client logs may be matched with
+// audit log.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+
+		next.ServeHTTP(w, app.contextSetRequestID(r, id))
+	})
+}
+
 // validateToken middleware function works with Authorization HTTP header to
 // permit calling protected API's if valid JSON web token (JWT)
-// provided by user.
+// provided by user. Responds with 401 and machine-readable error code if
+// token is missing or fails any check of authenticate.
 func (app *application) validateToken(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
 
-		authHeader := r.Header.Get("Authorization")
-
-		if authHeader == "" {
-			// could set an anonymous user
-		}
-
-		// Only permit if auth header is of 2 string parts.
-		headerParts := strings.Split(authHeader, " ")
-		if len(headerParts) != 2 {
-			app.errorJSON(w, errors.New("invalid auth header"))
+		user, claims, authErr := app.authenticate(r)
+		if authErr != nil {
+			app.authErrorJSON(w, authErr)
 			return
 		}
 
-		// Only permit auth header is of Bearer type
-		if headerParts[0] != "Bearer" {
-			app.errorJSON(w, errors.New("unauthorized: no Bearer"))
-			return
-		}
+		// Authenticated user is available for handlers by contextGetUser,
+		// token claims - by contextGetClaims
+		r = app.contextSetClaims(r, claims)
+		next.ServeHTTP(w, app.contextSetUser(r, user))
+	})
+}
 
-		// Parsing JWT with known secret from app's configuration
-		token := headerParts[1]
-		claims, err := jwt.HMACCheck([]byte(token), []byte(app.config.jwt.secret))
-		if err != nil {
-			app.errorJSON(w, errors.New("unauthorized: failed HMAC check"), http.StatusForbidden)
+// identifyUser middleware authenticates request with Authorization header
+// as validateToken does, so handlers of public APIs may check permissions
+// of user. Requests without the header pass as anonymous ones.
+func (app *application) identifyUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			w.Header().Add("Vary", "Authorization")
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		// Token may be expired
-		if !claims.Valid(time.Now()) {
-			if err != nil {
-				app.errorJSON(w, errors.New("unauthorized: token exprired"), http.StatusForbidden)
-				return
-			}
-		}
+		app.validateToken(next).ServeHTTP(w, r)
+	})
+}
 
-		// Current audience is provided from config, this is a temporary solution.
-		// Should match the list of accepted audiences.
-		currentAudience := strings.SplitN(app.config.jwt.audiences, ",", 2)[0]
-		if !claims.AcceptAudience(currentAudience) {
-			if err != nil {
-				app.errorJSON(w, errors.New("unauthorized: invalid audience"), http.StatusForbidden)
+// requirePermission middleware function permits calling protected API only
+// if authenticated user's role grants permission, otherwise responds with
+// 403. It must be chained after validateToken middleware.
+func (app *application) requirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if authErr := app.authorize(app.contextGetUser(r), permission); authErr != nil {
+				app.authErrorJSON(w, authErr)
 				return
 			}
-		}
 
-		// Current issuer ID is provided from config, this is a temporary solution.
-		// Should match the issuer from server enviroment.
-		if claims.Issuer != app.config.jwt.issuer {
-			if err != nil {
-				app.errorJSON(w, errors.New("unauthorized: invalid issuer"), http.StatusForbidden)
-				return
-			}
-		}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
 
-		// Subject finally is our user ID, note it might not match user's email.
-		// Extract returning value if needed for contexting or any other purposes.
-		_, err = strconv.ParseInt(claims.Subject, 10, 64)
-		if err != nil {
-			app.errorJSON(w, errors.New("unauthorized"), http.StatusForbidden)
-			return
-		}
+// deprecated middleware function marks responses of deprecated API by
+// Deprecation header and links its successor, in which ":id" is replaced by
+// id parameter of request path.
+func (app *application) deprecated(successor string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			params := httprouter.ParamsFromContext(r.Context())
+			link := strings.Replace(successor, ":id", params.ByName("id"), 1)
 
-		next.ServeHTTP(w, r)
-	})
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", "<"+link+`>; rel="successor-version"`)
+
+			next.ServeHTTP(w, r)
+		})
+	}
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"backend/models"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestAuthorization(t *testing.T) {
+	ta := newTestApp(t)
+	id := ta.insertUser(t, "user@test.local", models.RoleViewer, true)
+	rolePath := fmt.Sprintf("/v1/admin/users/%d/role", id)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		role   string
+		body   string
+		header map[string]string
+		status int
+		code   string
+	}{
+		{
+			name:   "public listing",
+			method: http.MethodGet,
+			path:   "/v1/movies",
+			status: http.StatusOK,
+		},
+		{
+			name:   "no token",
+			method: http.MethodPost,
+			path:   "/v1/movies",
+			status: http.StatusUnauthorized,
+			code:   ErrCodeMissingToken,
+		},
+		{
+			name:   "invalid token",
+			method: http.MethodPost,
+			path:   "/v1/movies",
+			header: map[string]string{"Authorization": "Bearer invalid"},
+			status: http.StatusUnauthorized,
+			code:   ErrCodeInvalidSignature,
+		},
+		{
+			name:   "viewer can't write movies",
+			method: http.MethodDelete,
+			path:   "/v1/movies/1",
+			role:   models.RoleViewer,
+			status: http.StatusForbidden,
+			code:   ErrCodeNotEnoughRights,
+		},
+		{
+			name:   "editor writes movies",
+			method: http.MethodDelete,
+			path:   "/v1/movies/1",
+			role:   models.RoleEditor,
+			status: http.StatusNoContent,
+		},
+		{
+			name:   "editor can't manage users",
+			method: http.MethodPut,
+			path:   rolePath,
+			role:   models.RoleEditor,
+			body:   `{"role":"admin"}`,
+			status: http.StatusForbidden,
+			code:   ErrCodeNotEnoughRights,
+		},
+		{
+			name:   "admin manages users",
+			method: http.MethodPut,
+			path:   rolePath,
+			role:   models.RoleAdmin,
+			body:   `{"role":"editor"}`,
+			status: http.StatusOK,
+		},
+		{
+			name:   "unknown role",
+			method: http.MethodPut,
+			path:   rolePath,
+			role:   models.RoleAdmin,
+			body:   `{"role":"owner"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "unknown user",
+			method: http.MethodPut,
+			path:   "/v1/admin/users/999/role",
+			role:   models.RoleAdmin,
+			body:   `{"role":"editor"}`,
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ta.request(t, tt.method, tt.path, tt.role, tt.body, tt.header)
+			checkResponse(t, res, tt.status, tt.code)
+		})
+	}
+
+	// New role is granted since the next signin
+	res := ta.signin(t, "user@test.local", testPassword)
+	checkResponse(t, res, http.StatusOK, "")
+
+	var tokens TokensResponse
+	decodeBody(t, res, &tokens)
+
+	res = ta.request(t, http.MethodDelete, "/v1/movies/2", "", "", map[string]string{
+		"Authorization": "Bearer " + tokens.Response,
+	})
+	checkResponse(t, res, http.StatusNoContent, "")
+}
@@ -2,11 +2,11 @@ package main
 
 import (
 	"backend/models"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
@@ -24,6 +24,52 @@ type MoviePayload struct {
 	Runtime     string `json:"runtime"`
 	Rating      string `json:"rating"`
 	MPAARating  string `json:"mpaa_rating"`
+	// Genres of movie, if omitted genres of existing movie stay untouched
+	GenreIDs []int `json:"genre_ids"`
+}
+
+// MovieInput is a type of client payload of movie create and update APIs.
+// Fields are pointers, so fields omitted in payload can be told from zero
+// values. Year is taken from release date.
+type MovieInput struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	ReleaseDate *string `json:"release_date"`
+	Runtime     *int    `json:"runtime"`
+	Rating      *int    `json:"rating"`
+	MPAARating  *string `json:"mpaa_rating"`
+	GenreIDs    *[]int  `json:"genre_ids"`
+}
+
+// apply function sets movie fields present in input, adding validation
+// errors of fields which can't be converted.
+func (input MovieInput) apply(v *validator, movie *models.Movie) {
+	if input.Title != nil {
+		movie.Title = strings.TrimSpace(*input.Title)
+	}
+	if input.Description != nil {
+		movie.Description = *input.Description
+	}
+	if input.ReleaseDate != nil {
+		movie.ReleaseDate = parseDate(v, "release_date", *input.ReleaseDate)
+		movie.Year = movie.ReleaseDate.Year()
+	}
+	if input.Runtime != nil {
+		movie.Runtime = *input.Runtime
+	}
+	if input.Rating != nil {
+		movie.Rating = *input.Rating
+	}
+	if input.MPAARating != nil {
+		movie.MPAARating = *input.MPAARating
+	}
+}
+
+// conflictResp is a type of 412 Precondition Failed response payload, it
+// has current movie, so client can merge its changes.
+type conflictResp struct {
+	Error jsonError     `json:"error"`
+	Movie *models.Movie `json:"movie"`
 }
 
 // jsonResp is a simple type for success client response payload serialization
@@ -35,21 +81,19 @@ type jsonResp struct {
 
 // getOneMovie API handler returns models.Movie object by its movie ID.
 func (app *application) getOneMovie(w http.ResponseWriter, r *http.Request) {
-	params := httprouter.ParamsFromContext(r.Context())
-
-	id, err := strconv.Atoi(params.ByName("id"))
+	id, err := readIDParam(r)
 	if err != nil {
-		app.logger.Println(errors.New("invalid ID parameter"))
 		app.errorJSON(w, err)
 		return
 	}
 
 	movie, err := app.models.DB.Get(id)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("cannot get the movie from db with id %d due to error: %+v", id, err))
+		app.movieReadError(w, err)
 		return
 	}
 
+	w.Header().Set("ETag", movieETag(movie))
 	err = app.writeJSON(w, http.StatusOK, movie, "movie")
 	if err != nil {
 		app.errorJSON(w, err)
@@ -58,15 +102,33 @@ func (app *application) getOneMovie(w http.ResponseWriter, r *http.Request) {
 
 }
 
-// getAllMovies API handler returns all of []models.Movie objects found.
+// moviesPage is a type for paginated movies listing response serialization.
+type moviesPage struct {
+	Movies   []*models.Movie `json:"movies"`
+	Metadata models.Metadata `json:"metadata"`
+}
+
+// getAllMovies API handler returns one page of []models.Movie objects found,
+// filtered and sorted as requested by query string parameters (see
+// readMovieFilter), together with pagination metadata.
 func (app *application) getAllMovies(w http.ResponseWriter, r *http.Request) {
-	movies, err := app.models.DB.All()
+	filter, err := readMovieFilter(r.URL.Query())
 	if err != nil {
 		app.errorJSON(w, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, movies, "movies")
+	movies, meta, err := app.models.DB.List(filter)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCursor) {
+			app.errorJSON(w, errors.New("invalid cursor parameter"))
+			return
+		}
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, moviesPage{Movies: movies, Metadata: meta})
 	if err != nil {
 		app.errorJSON(w, err)
 		return
@@ -74,9 +136,18 @@ func (app *application) getAllMovies(w http.ResponseWriter, r *http.Request) {
 
 }
 
-// getAllGenres API handler returns all of []models.Genre objects found.
+// getAllGenres API handler returns all of []models.Genre objects found. With
+// counts=true query string parameter every genre has number of its movies.
 func (app *application) getAllGenres(w http.ResponseWriter, r *http.Request) {
-	genres, err := app.models.DB.GenresAll()
+	counts, _ := strconv.ParseBool(r.URL.Query().Get("counts"))
+
+	var genres []*models.Genre
+	var err error
+	if counts {
+		genres, err = app.models.DB.GenresWithCounts()
+	} else {
+		genres, err = app.models.DB.GenresAll()
+	}
 	if err != nil {
 		app.errorJSON(w, err)
 		return
@@ -114,23 +185,198 @@ func (app *application) getAllMoviesByGenre(w http.ResponseWriter, r *http.Reque
 
 }
 
-// deleteMovie API handler deletes selected movie from db and returns empty
-// success response to user. NOTE: response status here is 200 OK.
+// createMovie API handler creates a new movie linked with genres of payload
+// genre IDs. Responds with 201 Created, the movie and its URL in Location
+// header.
+func (app *application) createMovie(w http.ResponseWriter, r *http.Request) {
+	v := newValidator()
+
+	var input MovieInput
+	if err := decodeJSON(r, &input, v); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	var movie models.Movie
+	input.apply(v, &movie)
+	validateMovie(v, &movie)
+
+	var genreIDs []int
+	if input.GenreIDs != nil {
+		genreIDs = *input.GenreIDs
+		validateGenreIDs(v, genreIDs)
+	}
+
+	if !v.Valid() {
+		app.failedValidation(w, v.Errors)
+		return
+	}
+
+	now := time.Now()
+	movie.CreatedAt = now
+	movie.UpdatedAt = now
+
+	id, err := app.storeFor(r).InsertMovie(movie, genreIDs)
+	if err != nil {
+		app.movieWriteError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/v1/movies/%d", id))
+	app.writeMovie(w, http.StatusCreated, id)
+
+}
+
+// updateMovie API handler updates movie by its ID and responds with the
+// updated movie. PUT request replaces all movie fields and genres, fields
+// omitted in payload are reset. PATCH request changes only fields present
+// in payload. If-Match header with movie ETag is required: if movie was
+// changed since, responds with 412 Precondition Failed and current movie.
+func (app *application) updateMovie(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	if r.Header.Get("If-Match") == "" {
+		app.errorCodeJSON(w, errors.New("If-Match header with movie ETag is required"), "precondition_required", http.StatusPreconditionRequired)
+		return
+	}
+
+	v := newValidator()
+
+	var input MovieInput
+	if err := decodeJSON(r, &input, v); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	stored, err := app.models.DB.Get(id)
+	if err != nil {
+		app.movieReadError(w, err)
+		return
+	}
+
+	if !ifMatch(r, movieETag(stored)) {
+		app.movieConflict(w, id)
+		return
+	}
+
+	// Stored version is kept, so the update fails if movie is changed
+	// concurrently
+	movie := *stored
+	genreIDs := []int{}
+
+	if r.Method == http.MethodPut {
+		movie = models.Movie{ID: stored.ID, CreatedAt: stored.CreatedAt, Version: stored.Version}
+	} else if input.GenreIDs == nil {
+		// Genres stay untouched
+		genreIDs = nil
+	}
+
+	if input.GenreIDs != nil {
+		genreIDs = *input.GenreIDs
+		validateGenreIDs(v, genreIDs)
+	}
+
+	// Resulting movie is validated, so PATCH can't break it
+	input.apply(v, &movie)
+	validateMovie(v, &movie)
+
+	if !v.Valid() {
+		app.failedValidation(w, v.Errors)
+		return
+	}
+	movie.UpdatedAt = time.Now()
+
+	err = app.storeFor(r).UpdateMovie(movie, genreIDs)
+	if errors.Is(err, models.ErrEditConflict) {
+		app.movieConflict(w, id)
+		return
+	}
+	if err != nil {
+		app.movieWriteError(w, err)
+		return
+	}
+
+	app.writeMovie(w, http.StatusOK, id)
+
+}
+
+// deleteMovie API handler moves movie by its ID to trash, responds with 204
+// No Content.
 func (app *application) deleteMovie(w http.ResponseWriter, r *http.Request) {
-	params := httprouter.ParamsFromContext(r.Context())
+	id, err := readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	if err := app.storeFor(r).DeleteMovie(id); err != nil {
+		app.movieWriteError(w, err)
+		return
+	}
 
-	id, err := strconv.Atoi(params.ByName("id"))
+	w.WriteHeader(http.StatusNoContent)
+
+}
+
+// getTrash API handler returns all of []models.Movie objects in trash, the
+// most recently deleted first.
+func (app *application) getTrash(w http.ResponseWriter, r *http.Request) {
+	movies, err := app.models.DB.DeletedMovies()
 	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, movies, "movies"); err != nil {
 		app.errorJSON(w, err)
 		return
 	}
 
-	err = app.models.DB.DeleteMovie(id)
+}
+
+// restoreMovie API handler takes movie by its ID out of trash together with
+// its genres and responds with the restored movie.
+func (app *application) restoreMovie(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
 	if err != nil {
 		app.errorJSON(w, err)
 		return
 	}
 
+	if err := app.storeFor(r).RestoreMovie(id); err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.errorJSON(w, errors.New("movie not found in trash"), http.StatusNotFound)
+			return
+		}
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeMovie(w, http.StatusOK, id)
+
+}
+
+// legacyDeleteMovie API handler deletes selected movie from db and returns
+// empty success response to user. NOTE: response status here is 200 OK.
+//
+// Deprecated: use deleteMovie.
+func (app *application) legacyDeleteMovie(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.storeFor(r).DeleteMovie(id)
+	if err != nil {
+		app.movieWriteError(w, err)
+		return
+	}
+
 	ok := jsonResp{
 		OK: true,
 	}
@@ -142,46 +388,72 @@ func (app *application) deleteMovie(w http.ResponseWriter, r *http.Request) {
 }
 
 // editMovie API handler updates movie in db or creates a new one, depending on
-// payload movie ID. Responds with 200 OK when movie is updated and with
-// 201 Created when movie is created.
+// payload movie ID, and links it with genres of payload genre IDs. Responds
+// with 200 OK when movie is updated and with 201 Created when movie is
+// created.
+//
+// Deprecated: use createMovie and updateMovie.
 func (app *application) editMovie(w http.ResponseWriter, r *http.Request) {
-	var payload MoviePayload
+	v := newValidator()
 
-	err := json.NewDecoder(r.Body).Decode(&payload)
-	if err != nil {
+	var payload MoviePayload
+	if err := decodeJSON(r, &payload, v); err != nil {
 		app.errorJSON(w, err)
 		return
 	}
 
 	var movie models.Movie
 
-	if payload.ID != "0" {
-		id, _ := strconv.Atoi(payload.ID)
-		m, _ := app.models.DB.Get(id)
+	// Empty or "0" ID means a new movie
+	if payload.ID != "" && payload.ID != "0" {
+		id, err := strconv.Atoi(payload.ID)
+		if err != nil || id < 1 {
+			v.AddError("id", "must be a positive integer")
+			app.failedValidation(w, v.Errors)
+			return
+		}
+
+		m, err := app.models.DB.Get(id)
+		if err != nil {
+			app.movieReadError(w, err)
+			return
+		}
+
+		// If-Match is optional here, old clients don't send it
+		if r.Header.Get("If-Match") != "" && !ifMatch(r, movieETag(m)) {
+			app.movieConflict(w, id)
+			return
+		}
 		movie = *m
-		movie.UpdatedAt = time.Now()
 	} else {
 		movie.CreatedAt = time.Now()
 	}
 
-	movie.ID, _ = strconv.Atoi(payload.ID)
-	movie.Title = payload.Title
+	movie.Title = strings.TrimSpace(payload.Title)
 	movie.Description = payload.Desription
-	movie.ReleaseDate, _ = time.Parse("2006-01-02", payload.ReleaseDate)
+	movie.ReleaseDate = parseDate(v, "release_date", payload.ReleaseDate)
 	movie.Year = movie.ReleaseDate.Year()
-	movie.Runtime, _ = strconv.Atoi(payload.Runtime)
-	movie.Rating, _ = strconv.Atoi(payload.Rating)
+	movie.Runtime = parseInt(v, "runtime", payload.Runtime)
+	movie.Rating = parseInt(v, "rating", payload.Rating)
 	movie.MPAARating = payload.MPAARating
 	movie.UpdatedAt = time.Now()
 
+	validateMovie(v, &movie)
+	validateGenreIDs(v, payload.GenreIDs)
+
+	if !v.Valid() {
+		app.failedValidation(w, v.Errors)
+		return
+	}
+
 	ok := jsonResp{
 		OK: true,
 	}
 
 	if movie.ID == 0 {
-		err = app.models.DB.InsertMovie(movie)
+		_, err := app.storeFor(r).InsertMovie(movie, payload.GenreIDs)
 		if err != nil {
-			app.errorJSON(w, err)
+			app.movieWriteError(w, err)
 			return
 		}
 
@@ -190,9 +462,13 @@ func (app *application) editMovie(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	} else {
-		err = app.models.DB.UpdateMovie(movie)
+		err := app.storeFor(r).UpdateMovie(movie, payload.GenreIDs)
+		if errors.Is(err, models.ErrEditConflict) {
+			app.movieConflict(w, movie.ID)
+			return
+		}
 		if err != nil {
-			app.errorJSON(w, err)
+			app.movieWriteError(w, err)
 			return
 		}
 
@@ -204,7 +480,123 @@ func (app *application) editMovie(w http.ResponseWriter, r *http.Request) {
 
 }
 
-// TODO: searchMovies API handler -- no description so far
+// movieETag function returns ETag of movie, it changes with every update.
+func movieETag(movie *models.Movie) string {
+	return fmt.Sprintf(`"%d"`, movie.Version)
+}
+
+// writeMovie function responds with movie by its ID and its ETag.
+func (app *application) writeMovie(w http.ResponseWriter, status, id int) {
+	movie, err := app.models.DB.Get(id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", movieETag(movie))
+	if err := app.writeJSON(w, status, movie, "movie"); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// movieConflict function responds with 412 Precondition Failed, current
+// movie by its ID and its ETag.
+func (app *application) movieConflict(w http.ResponseWriter, id int) {
+	movie, err := app.models.DB.Get(id)
+	if err != nil {
+		app.movieReadError(w, err)
+		return
+	}
+
+	resp := conflictResp{
+		Error: jsonError{
+			StatusCode: http.StatusPreconditionFailed,
+			Code:       "edit_conflict",
+			Message:    "movie was changed by someone else, merge your changes with the current movie",
+		},
+		Movie: movie,
+	}
+
+	w.Header().Set("ETag", movieETag(movie))
+	if err := app.writeJSON(w, http.StatusPreconditionFailed, resp); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// movieReadError function responds with error of movie read: 404 for
+// missing movie, 500 otherwise.
+func (app *application) movieReadError(w http.ResponseWriter, err error) {
+	if errors.Is(err, models.ErrNoRecord) {
+		app.errorJSON(w, errors.New("movie not found"), http.StatusNotFound)
+		return
+	}
+
+	app.errorJSON(w, err, http.StatusInternalServerError)
+}
+
+// movieWriteError function responds with error of movie insert or update:
+// 422 for unknown genres, 404 for missing movie, 500 otherwise.
+func (app *application) movieWriteError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrUnknownGenre):
+		app.failedValidation(w, map[string]string{
+			"genre_ids": strings.TrimPrefix(err.Error(), "models: "),
+		})
+	case errors.Is(err, models.ErrNoRecord):
+		app.errorJSON(w, errors.New("movie not found"), http.StatusNotFound)
+	default:
+		app.errorJSON(w, err, http.StatusInternalServerError)
+	}
+}
+
+// getOneMovieOrSearch API handler serves GET /v1/movies/search by
+// searchMovies and GET /v1/movies/:id by getOneMovie, httprouter can't route
+// a static segment beside :id parameter.
+func (app *application) getOneMovieOrSearch(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	if params.ByName("id") == "search" {
+		app.searchMovies(w, r)
+		return
+	}
+
+	app.getOneMovie(w, r)
+
+}
+
+// searchMovies API handler returns []models.SearchResult objects found by
+// full-text search over movie titles and descriptions, ordered by rank.
+// Query string parameters: q - search query (required), limit - maximum
+// number of results.
 func (app *application) searchMovies(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	query := strings.TrimSpace(qs.Get("q"))
+	if query == "" {
+		app.errorJSON(w, errors.New("q parameter is required"))
+		return
+	}
+
+	limit, err := readInt(qs, "limit", DEFAULT_PAGE_LIMIT)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	if limit < 1 || limit > MAX_PAGE_LIMIT {
+		app.errorJSON(w, fmt.Errorf("limit parameter must be between 1 and %d", MAX_PAGE_LIMIT))
+		return
+	}
+
+	results, err := app.models.DB.Search(query, limit)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, results, "results"); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
 
 }
@@ -0,0 +1,607 @@
+package main
+
+import (
+	"backend/models"
+	"net/http"
+	"testing"
+)
+
+// movieResponse type is a body of one movie response
+type movieResponse struct {
+	Movie models.Movie `json:"movie"`
+}
+
+func TestGetOneMovie(t *testing.T) {
+	ta := newTestApp(t)
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		title  string
+		genres int
+	}{
+		{
+			name:   "movie with genres",
+			path:   "/v1/movies/1",
+			status: http.StatusOK,
+			title:  "The Shawshank Redemption",
+			genres: 2,
+		},
+		{
+			name:   "unknown movie",
+			path:   "/v1/movies/999",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "invalid ID",
+			path:   "/v1/movies/first",
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ta.request(t, http.MethodGet, tt.path, "", "", nil)
+			checkResponse(t, res, tt.status, "")
+
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var body movieResponse
+			decodeBody(t, res, &body)
+			if body.Movie.Title != tt.title || len(body.Movie.MovieGenre) != tt.genres {
+				t.Errorf("movie %+v, expected %s with %d genres", body.Movie, tt.title, tt.genres)
+			}
+		})
+	}
+}
+
+// moviesResponse type is a body of movies listing response
+type moviesResponse struct {
+	Movies   []models.Movie  `json:"movies"`
+	Metadata models.Metadata `json:"metadata"`
+}
+
+// allTitles are titles of all movies of the sample dataset ordered by title
+var allTitles = []string{
+	"American Psycho", "Back to the Future", "Casablanca", "Groundhog Day", "Inception",
+	"Memento", "Star Wars", "The Dark Knight", "The Godfather", "The Shawshank Redemption",
+}
+
+func TestListMovies(t *testing.T) {
+	ta := newTestApp(t)
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		titles []string
+		total  int
+	}{
+		{
+			name:   "all movies without pagination",
+			status: http.StatusOK,
+			titles: allTitles,
+			total:  10,
+		},
+		{
+			name:   "first page",
+			query:  "?limit=3",
+			status: http.StatusOK,
+			titles: []string{"American Psycho", "Back to the Future", "Casablanca"},
+			total:  10,
+		},
+		{
+			name:   "offset",
+			query:  "?limit=2&offset=3",
+			status: http.StatusOK,
+			titles: []string{"Groundhog Day", "Inception"},
+			total:  10,
+		},
+		{
+			name:   "sorted by year descending",
+			query:  "?limit=2&sort=year&order=desc",
+			status: http.StatusOK,
+			titles: []string{"Inception", "The Dark Knight"},
+			total:  10,
+		},
+		{
+			name:   "year range and MPAA rating",
+			query:  "?year_min=1990&year_max=2000&mpaa_rating=R",
+			status: http.StatusOK,
+			titles: []string{"American Psycho", "Memento", "The Shawshank Redemption"},
+			total:  3,
+		},
+		{
+			name:   "any of genres",
+			query:  "?genre_id=7,8",
+			status: http.StatusOK,
+			titles: []string{"Casablanca", "Groundhog Day", "Memento"},
+			total:  3,
+		},
+		{
+			name:   "rating range sorted by runtime",
+			query:  "?rating_max=4&sort=runtime",
+			status: http.StatusOK,
+			titles: []string{"Groundhog Day", "American Psycho", "Memento"},
+			total:  3,
+		},
+		{
+			name:   "offset past the end",
+			query:  "?offset=20",
+			status: http.StatusOK,
+			titles: []string{},
+			total:  10,
+		},
+		{
+			name:   "limit above maximum",
+			query:  "?limit=1000",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "negative offset",
+			query:  "?offset=-1",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "unknown sort field",
+			query:  "?sort=password",
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ta.request(t, http.MethodGet, "/v1/movies"+tt.query, "", "", nil)
+			checkResponse(t, res, tt.status, "")
+
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var body moviesResponse
+			decodeBody(t, res, &body)
+
+			titles := []string{}
+			for _, movie := range body.Movies {
+				titles = append(titles, movie.Title)
+			}
+			if !equalStrings(titles, tt.titles) {
+				t.Errorf("titles %q, expected %q", titles, tt.titles)
+			}
+			if body.Metadata.Total != tt.total {
+				t.Errorf("total %d, expected %d", body.Metadata.Total, tt.total)
+			}
+		})
+	}
+}
+
+func TestListMoviesByCursor(t *testing.T) {
+	ta := newTestApp(t)
+
+	var titles []string
+	query := "?limit=4"
+	for pages := 1; ; pages++ {
+		res := ta.request(t, http.MethodGet, "/v1/movies"+query, "", "", nil)
+		checkResponse(t, res, http.StatusOK, "")
+
+		var body moviesResponse
+		decodeBody(t, res, &body)
+		for _, movie := range body.Movies {
+			titles = append(titles, movie.Title)
+		}
+
+		if body.Metadata.NextCursor == "" {
+			if pages != 3 {
+				t.Errorf("%d pages, expected 3", pages)
+			}
+			break
+		}
+		if pages == 3 {
+			t.Fatal("next cursor of the last page")
+		}
+
+		query = "?limit=4&cursor=" + body.Metadata.NextCursor
+	}
+
+	if !equalStrings(titles, allTitles) {
+		t.Errorf("titles %q, expected %q", titles, allTitles)
+	}
+
+	res := ta.request(t, http.MethodGet, "/v1/movies?limit=4", "", "", nil)
+	var body moviesResponse
+	decodeBody(t, res, &body)
+
+	for _, query := range []string{
+		"?cursor=invalid",
+		"?sort=year&cursor=" + body.Metadata.NextCursor,
+	} {
+		res := ta.request(t, http.MethodGet, "/v1/movies"+query, "", "", nil)
+		checkResponse(t, res, http.StatusBadRequest, "")
+	}
+}
+
+// searchResponse type is a body of movies search response
+type searchResponse struct {
+	Results []models.SearchResult `json:"results"`
+}
+
+func TestSearchMovies(t *testing.T) {
+	ta := newTestApp(t)
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		titles []string
+	}{
+		{
+			name:   "prefixes of title words",
+			path:   "/v1/movies/search?q=star+wa",
+			status: http.StatusOK,
+			titles: []string{"Star Wars"},
+		},
+		{
+			name:   "description words ordered by rank",
+			path:   "/v1/movies/search?q=time",
+			status: http.StatusOK,
+			titles: []string{"Back to the Future", "Groundhog Day"},
+		},
+		{
+			name:   "limit",
+			path:   "/v1/movies/search?q=time&limit=1",
+			status: http.StatusOK,
+			titles: []string{"Back to the Future"},
+		},
+		{
+			name:   "nothing found",
+			path:   "/v1/movies/search?q=zombies",
+			status: http.StatusOK,
+			titles: []string{},
+		},
+		{
+			name:   "missing query",
+			path:   "/v1/movies/search",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "limit above maximum",
+			path:   "/v1/movies/search?q=time&limit=1000",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "deprecated movie route",
+			path:   "/v1/movie/search?q=time",
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ta.request(t, http.MethodGet, tt.path, "", "", nil)
+			checkResponse(t, res, tt.status, "")
+
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var body searchResponse
+			decodeBody(t, res, &body)
+
+			titles := []string{}
+			for _, result := range body.Results {
+				titles = append(titles, result.Title)
+			}
+			if !equalStrings(titles, tt.titles) {
+				t.Errorf("titles %q, expected %q", titles, tt.titles)
+			}
+		})
+	}
+
+	res := ta.request(t, http.MethodGet, "/v1/movies/search?q=star+wa", "", "", nil)
+
+	var body searchResponse
+	decodeBody(t, res, &body)
+	if highlight := body.Results[0].TitleHighlight; highlight != "<b>Star</b> <b>Wars</b>" {
+		t.Errorf("title highlight %q, expected both words highlighted", highlight)
+	}
+}
+
+func TestMovieRoutes(t *testing.T) {
+	ta := newTestApp(t)
+
+	movie := `{"title":"Alien","release_date":"1979-05-25","runtime":117,"rating":5,"mpaa_rating":"R","genre_ids":[9]}`
+	anyVersion := map[string]string{"If-Match": "*"}
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		header map[string]string
+		status int
+		// Expected response headers
+		expect map[string]string
+	}{
+		{
+			name:   "create",
+			method: http.MethodPost,
+			path:   "/v1/movies",
+			body:   movie,
+			status: http.StatusCreated,
+			expect: map[string]string{"Location": "/v1/movies/11"},
+		},
+		{
+			name:   "get created",
+			method: http.MethodGet,
+			path:   "/v1/movies/11",
+			status: http.StatusOK,
+		},
+		{
+			name:   "replace",
+			method: http.MethodPut,
+			path:   "/v1/movies/11",
+			body:   movie,
+			header: anyVersion,
+			status: http.StatusOK,
+		},
+		{
+			name:   "update",
+			method: http.MethodPatch,
+			path:   "/v1/movies/11",
+			body:   `{"rating":4}`,
+			header: anyVersion,
+			status: http.StatusOK,
+		},
+		{
+			name:   "delete",
+			method: http.MethodDelete,
+			path:   "/v1/movies/11",
+			status: http.StatusNoContent,
+		},
+		{
+			name:   "update deleted",
+			method: http.MethodPatch,
+			path:   "/v1/movies/11",
+			body:   `{"rating":4}`,
+			header: anyVersion,
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "method not allowed",
+			method: http.MethodPost,
+			path:   "/v1/movies/1",
+			body:   movie,
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "deprecated route",
+			method: http.MethodGet,
+			path:   "/v1/movie/1",
+			status: http.StatusOK,
+			expect: map[string]string{
+				"Deprecation": "true",
+				"Link":        `</v1/movies/1>; rel="successor-version"`,
+			},
+		},
+	}
+
+	for _, step := range steps {
+		res := ta.request(t, step.method, step.path, models.RoleEditor, step.body, step.header)
+		if res.Code != step.status {
+			t.Fatalf("%s: status %d, expected %d, body %s", step.name, res.Code, step.status, res.Body)
+		}
+
+		for name, value := range step.expect {
+			if got := res.Header().Get(name); got != value {
+				t.Errorf("%s: %s header %q, expected %q", step.name, name, got, value)
+			}
+		}
+		if res.Code == http.StatusNoContent && res.Body.Len() > 0 {
+			t.Errorf("%s: body %s of no content response", step.name, res.Body)
+		}
+	}
+}
+
+func TestCreateMovieValidation(t *testing.T) {
+	ta := newTestApp(t)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		fields []string
+	}{
+		{
+			name:   "valid movie",
+			body:   `{"title":"Alien","release_date":"1979-05-25","runtime":117,"rating":5,"mpaa_rating":"R","genre_ids":[9]}`,
+			status: http.StatusCreated,
+		},
+		{
+			name:   "missing fields",
+			body:   `{}`,
+			status: http.StatusUnprocessableEntity,
+			fields: []string{"title", "release_date", "runtime"},
+		},
+		{
+			name:   "invalid values",
+			body:   `{"title":"Alien","release_date":"25.05.1979","runtime":117,"rating":10,"mpaa_rating":"X"}`,
+			status: http.StatusUnprocessableEntity,
+			fields: []string{"release_date", "rating", "mpaa_rating"},
+		},
+		{
+			name:   "wrong field type",
+			body:   `{"title":"Alien","release_date":"1979-05-25","runtime":"long"}`,
+			status: http.StatusUnprocessableEntity,
+			fields: []string{"runtime"},
+		},
+		{
+			name:   "unknown genre",
+			body:   `{"title":"Alien","release_date":"1979-05-25","runtime":117,"genre_ids":[999]}`,
+			status: http.StatusUnprocessableEntity,
+			fields: []string{"genre_ids"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ta.request(t, http.MethodPost, "/v1/movies", models.RoleEditor, tt.body, nil)
+
+			if tt.fields == nil {
+				checkResponse(t, res, tt.status, "")
+				if res.Header().Get("Location") == "" {
+					t.Error("no Location header of created movie")
+				}
+				return
+			}
+
+			checkResponse(t, res, tt.status, "validation_failed")
+
+			var body errorResponse
+			decodeBody(t, res, &body)
+			for _, field := range tt.fields {
+				if _, ok := body.Error.Fields[field]; !ok {
+					t.Errorf("no error of %s field, errors %v", field, body.Error.Fields)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateMoviePreconditions(t *testing.T) {
+	ta := newTestApp(t)
+
+	res := ta.request(t, http.MethodGet, "/v1/movies/1", "", "", nil)
+	checkResponse(t, res, http.StatusOK, "")
+	etag := res.Header().Get("ETag")
+
+	tests := []struct {
+		name    string
+		ifMatch string
+		status  int
+		code    string
+		etag    string
+	}{
+		{
+			name:   "missing If-Match",
+			status: http.StatusPreconditionRequired,
+			code:   "precondition_required",
+		},
+		{
+			name:    "stale version",
+			ifMatch: `"0"`,
+			status:  http.StatusPreconditionFailed,
+			code:    "edit_conflict",
+			etag:    etag,
+		},
+		{
+			name:    "current version",
+			ifMatch: etag,
+			status:  http.StatusOK,
+			etag:    `"2"`,
+		},
+		{
+			name:    "version changed by previous update",
+			ifMatch: etag,
+			status:  http.StatusPreconditionFailed,
+			code:    "edit_conflict",
+			etag:    `"2"`,
+		},
+		{
+			name:    "any version",
+			ifMatch: "*",
+			status:  http.StatusOK,
+			etag:    `"3"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := map[string]string{}
+			if tt.ifMatch != "" {
+				header["If-Match"] = tt.ifMatch
+			}
+
+			res := ta.request(t, http.MethodPatch, "/v1/movies/1", models.RoleEditor, `{"rating":4}`, header)
+			checkResponse(t, res, tt.status, tt.code)
+
+			if got := res.Header().Get("ETag"); got != tt.etag {
+				t.Errorf("ETag %s, expected %s", got, tt.etag)
+			}
+		})
+	}
+}
+
+func TestDeleteMovieToTrash(t *testing.T) {
+	ta := newTestApp(t)
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		role   string
+		status int
+	}{
+		{"delete", http.MethodDelete, "/v1/movies/2", models.RoleEditor, http.StatusNoContent},
+		{"deleted movie is hidden", http.MethodGet, "/v1/movies/2", "", http.StatusNotFound},
+		{"delete again", http.MethodDelete, "/v1/movies/2", models.RoleEditor, http.StatusNotFound},
+		{"restore", http.MethodPost, "/v1/admin/movies/2/restore", models.RoleEditor, http.StatusOK},
+		{"restored movie is visible", http.MethodGet, "/v1/movies/2", "", http.StatusOK},
+		{"restore movie not in trash", http.MethodPost, "/v1/admin/movies/2/restore", models.RoleEditor, http.StatusNotFound},
+	}
+
+	for _, step := range steps {
+		res := ta.request(t, step.method, step.path, step.role, "", nil)
+		if res.Code != step.status {
+			t.Fatalf("%s: status %d, expected %d, body %s", step.name, res.Code, step.status, res.Body)
+		}
+
+		if step.name != "delete" {
+			continue
+		}
+
+		// Trash and listings are checked while the movie is in trash
+		res = ta.request(t, http.MethodGet, "/v1/admin/movies/trash", models.RoleEditor, "", nil)
+		checkResponse(t, res, http.StatusOK, "")
+
+		var trash moviesResponse
+		decodeBody(t, res, &trash)
+		if len(trash.Movies) != 1 || trash.Movies[0].ID != 2 || len(trash.Movies[0].MovieGenre) == 0 {
+			t.Fatalf("trash %+v, expected movie 2 with its genres", trash.Movies)
+		}
+
+		res = ta.request(t, http.MethodGet, "/v1/movies?limit=100", "", "", nil)
+		var page moviesResponse
+		decodeBody(t, res, &page)
+		if page.Metadata.Total != 9 {
+			t.Fatalf("total %d of listing, expected 9 without deleted movie", page.Metadata.Total)
+		}
+	}
+
+	// Restore gives the movie a new version, which has its revision
+	revisions, err := ta.app.models.DB.MovieRevisions(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 || revisions[0].Revision != 2 || revisions[0].ActorID == nil {
+		t.Fatalf("revisions %+v, expected revision 2 by the editor and 1", revisions)
+	}
+}
+
+// equalStrings function reports whether a and b have the same strings in
+// the same order.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
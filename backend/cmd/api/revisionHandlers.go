@@ -0,0 +1,193 @@
+package main
+
+import (
+	"backend/models"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// revisionDiff is a type for diff of movie revisions response serialization.
+type revisionDiff struct {
+	From    int                           `json:"from"`
+	To      int                           `json:"to"`
+	Changes map[string]models.AuditChange `json:"changes"`
+}
+
+// getMovieRevisions API handler returns all of []models.MovieRevision
+// objects of movie by its ID, the latest first.
+func (app *application) getMovieRevisions(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	if _, err := app.models.DB.Get(id); err != nil {
+		app.movieReadError(w, err)
+		return
+	}
+
+	revisions, err := app.models.DB.MovieRevisions(id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, revisions, "revisions"); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+}
+
+// getMovieRevision API handler returns one models.MovieRevision object by
+// movie ID and revision.
+func (app *application) getMovieRevision(w http.ResponseWriter, r *http.Request) {
+	rev, ok := app.readRevision(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, rev, "revision"); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+}
+
+// diffMovieRevisions API handler returns fields of movie which differ
+// between revision of path and revision of "to" query string parameter,
+// the latest revision by default.
+func (app *application) diffMovieRevisions(w http.ResponseWriter, r *http.Request) {
+	from, ok := app.readRevision(w, r)
+	if !ok {
+		return
+	}
+
+	var to *models.MovieRevision
+	var err error
+	if s := r.URL.Query().Get("to"); s != "" {
+		rev, convErr := strconv.Atoi(s)
+		if convErr != nil {
+			app.errorJSON(w, errors.New("invalid to parameter: must be an integer"))
+			return
+		}
+		to, err = app.models.DB.MovieRevision(from.MovieID, rev)
+	} else {
+		var revisions []*models.MovieRevision
+		revisions, err = app.models.DB.MovieRevisions(from.MovieID)
+		if err == nil {
+			// There is at least the revision diff is made from
+			to = revisions[0]
+		}
+	}
+	if err != nil {
+		app.revisionReadError(w, err)
+		return
+	}
+
+	diff := revisionDiff{
+		From:    from.Revision,
+		To:      to.Revision,
+		Changes: models.DiffRevisions(from, to),
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, diff, "diff"); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+}
+
+// restoreMovieRevision API handler reverts movie fields and genres to the
+// ones of revision. It's an update of movie, so it's saved as a new
+// revision. If-Match header with movie ETag is required, as for updates.
+// Responds with the updated movie.
+func (app *application) restoreMovieRevision(w http.ResponseWriter, r *http.Request) {
+	rev, ok := app.readRevision(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Header.Get("If-Match") == "" {
+		app.errorCodeJSON(w, errors.New("If-Match header with movie ETag is required"), "precondition_required", http.StatusPreconditionRequired)
+		return
+	}
+
+	stored, err := app.models.DB.Get(rev.MovieID)
+	if err != nil {
+		app.movieReadError(w, err)
+		return
+	}
+
+	if !ifMatch(r, movieETag(stored)) {
+		app.movieConflict(w, stored.ID)
+		return
+	}
+
+	movie := rev.Movie
+	movie.ID = stored.ID
+	movie.CreatedAt = stored.CreatedAt
+	movie.Version = stored.Version
+	movie.UpdatedAt = time.Now()
+	movie.DeletedAt = nil
+	movie.MovieGenre = nil
+
+	err = app.storeFor(r).UpdateMovie(movie, rev.GenreIDs)
+	switch {
+	case errors.Is(err, models.ErrEditConflict):
+		app.movieConflict(w, stored.ID)
+		return
+	case errors.Is(err, models.ErrUnknownGenre):
+		msg := strings.TrimPrefix(err.Error(), "models: ")
+		app.errorJSON(w, errors.New("revision can't be restored, "+msg), http.StatusConflict)
+		return
+	case err != nil:
+		app.movieWriteError(w, err)
+		return
+	}
+
+	app.writeMovie(w, http.StatusOK, stored.ID)
+
+}
+
+// readRevision function returns revision by movie ID and revision of
+// request path. If it can't be read, error is responded and ok is false.
+func (app *application) readRevision(w http.ResponseWriter, r *http.Request) (*models.MovieRevision, bool) {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return nil, false
+	}
+
+	params := httprouter.ParamsFromContext(r.Context())
+	revision, err := strconv.Atoi(params.ByName("rev"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid revision parameter"))
+		return nil, false
+	}
+
+	rev, err := app.models.DB.MovieRevision(id, revision)
+	if err != nil {
+		app.revisionReadError(w, err)
+		return nil, false
+	}
+
+	return rev, true
+}
+
+// revisionReadError function responds with error of revision read: 404 for
+// missing revision, 500 otherwise.
+func (app *application) revisionReadError(w http.ResponseWriter, err error) {
+	if errors.Is(err, models.ErrNoRecord) {
+		app.errorJSON(w, errors.New("revision not found"), http.StatusNotFound)
+		return
+	}
+
+	app.errorJSON(w, err, http.StatusInternalServerError)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"backend/models"
+	"net/http"
+	"testing"
+)
+
+func TestMovieRevisions(t *testing.T) {
+	ta := newTestApp(t)
+
+	res := ta.request(t, http.MethodPatch, "/v1/movies/1", models.RoleEditor, `{"rating":2,"genre_ids":[1]}`, map[string]string{"If-Match": `"1"`})
+	checkResponse(t, res, http.StatusOK, "")
+
+	t.Run("list", func(t *testing.T) {
+		res := ta.request(t, http.MethodGet, "/v1/movies/1/revisions", models.RoleEditor, "", nil)
+		checkResponse(t, res, http.StatusOK, "")
+
+		var body struct {
+			Revisions []models.MovieRevision `json:"revisions"`
+		}
+		decodeBody(t, res, &body)
+
+		if len(body.Revisions) != 2 || body.Revisions[0].Revision != 2 || body.Revisions[1].Revision != 1 {
+			t.Fatalf("revisions %+v, expected 2 and 1", body.Revisions)
+		}
+		if body.Revisions[0].ActorID == nil {
+			t.Error("no author of update revision")
+		}
+		if body.Revisions[1].ActorID == nil || *body.Revisions[1].ActorID != models.SYSTEM_ACTOR_ID {
+			t.Error("sample dataset revision isn't authored by seed job")
+		}
+	})
+
+	t.Run("diff", func(t *testing.T) {
+		res := ta.request(t, http.MethodGet, "/v1/movies/1/revisions/1/diff", models.RoleEditor, "", nil)
+		checkResponse(t, res, http.StatusOK, "")
+
+		var body struct {
+			Diff revisionDiff `json:"diff"`
+		}
+		decodeBody(t, res, &body)
+
+		if body.Diff.From != 1 || body.Diff.To != 2 {
+			t.Errorf("diff of %d and %d, expected 1 and 2", body.Diff.From, body.Diff.To)
+		}
+		for _, field := range []string{"rating", "genre_ids"} {
+			if _, ok := body.Diff.Changes[field]; !ok {
+				t.Errorf("no change of %s, changes %v", field, body.Diff.Changes)
+			}
+		}
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		role   string
+		header map[string]string
+		status int
+		code   string
+	}{
+		{
+			name:   "viewer can't restore",
+			path:   "/v1/movies/1/revisions/1/restore",
+			role:   models.RoleViewer,
+			header: map[string]string{"If-Match": `"2"`},
+			status: http.StatusForbidden,
+			code:   ErrCodeNotEnoughRights,
+		},
+		{
+			name:   "unknown revision",
+			path:   "/v1/movies/1/revisions/9/restore",
+			role:   models.RoleEditor,
+			header: map[string]string{"If-Match": `"2"`},
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "missing If-Match",
+			path:   "/v1/movies/1/revisions/1/restore",
+			role:   models.RoleEditor,
+			status: http.StatusPreconditionRequired,
+			code:   "precondition_required",
+		},
+		{
+			name:   "stale version",
+			path:   "/v1/movies/1/revisions/1/restore",
+			role:   models.RoleEditor,
+			header: map[string]string{"If-Match": `"1"`},
+			status: http.StatusPreconditionFailed,
+			code:   "edit_conflict",
+		},
+		{
+			name:   "current version",
+			path:   "/v1/movies/1/revisions/1/restore",
+			role:   models.RoleEditor,
+			header: map[string]string{"If-Match": `"2"`},
+			status: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ta.request(t, http.MethodPost, tt.path, tt.role, "", tt.header)
+			checkResponse(t, res, tt.status, tt.code)
+		})
+	}
+
+	// Restore is an update, so it's saved as a new revision
+	res = ta.request(t, http.MethodGet, "/v1/movies/1", "", "", nil)
+
+	var body movieResponse
+	decodeBody(t, res, &body)
+	if body.Movie.Rating != 5 || body.Movie.Version != 3 || len(body.Movie.MovieGenre) != 2 {
+		t.Errorf("restored movie %+v, expected version 3 with rating 5 and both genres of revision 1", body.Movie)
+	}
+}
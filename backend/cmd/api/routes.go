@@ -1,6 +1,7 @@
 package main
 
 import (
+	"backend/models"
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
@@ -16,25 +17,74 @@ func (app *application) routes() http.Handler {
 	// New chain with token validation middleware for protected APIs
 	secure := alice.New(app.validateToken)
 
+	// Chains of protected APIs requiring user's role permissions
+	moviesWriter := secure.Append(app.requirePermission(models.PermMoviesWrite))
+	genresWriter := secure.Append(app.requirePermission(models.PermGenresWrite))
+	usersManager := secure.Append(app.requirePermission(models.PermUsersManage))
+	auditReader := secure.Append(app.requirePermission(models.PermAuditRead))
+
 	// App status handler
 	router.HandlerFunc(http.MethodGet, "/status", app.statusHandler)
 
-	// GraphQL handlers
-	router.HandlerFunc(http.MethodPost, "/v1/graphql", app.moviesGraphQL)
+	// GraphQL handlers, mutations check permissions of authenticated user
+	graphql := alice.New(app.identifyUser).ThenFunc(app.moviesGraphQL)
+	router.GET("/v1/graphql", app.wrap(graphql))
+	router.POST("/v1/graphql", app.wrap(graphql))
 
-	// User signin handler
+	// User signin, signup and account recovery handlers
 	router.HandlerFunc(http.MethodPost, "/v1/signin", app.Signin)
+	router.HandlerFunc(http.MethodPost, "/v1/signup", app.Signup)
+	router.HandlerFunc(http.MethodPost, "/v1/users/verify", app.verifyEmail)
+	router.HandlerFunc(http.MethodPost, "/v1/password/forgot", app.forgotPassword)
+	router.HandlerFunc(http.MethodPost, "/v1/password/reset", app.resetPassword)
+	router.HandlerFunc(http.MethodPost, "/v1/token/refresh", app.refreshToken)
+	router.HandlerFunc(http.MethodGet, "/.well-known/jwks.json", app.jwks)
+	router.POST("/v1/signout", app.wrap(secure.ThenFunc(app.signout)))
 
 	// Movies collection handlers
-	router.HandlerFunc(http.MethodGet, "/v1/movie/:id", app.getOneMovie)
 	router.HandlerFunc(http.MethodGet, "/v1/movies", app.getAllMovies)
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:genre_id", app.getAllMoviesByGenre)
-	router.POST("/v1/admin/editmovie", app.wrap(secure.ThenFunc(app.editMovie)))
-	router.GET("/v1/admin/deletemovie/:id", app.wrap(secure.ThenFunc(app.deleteMovie)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.getOneMovieOrSearch)
+	router.POST("/v1/movies", app.wrap(moviesWriter.ThenFunc(app.createMovie)))
+	router.PUT("/v1/movies/:id", app.wrap(moviesWriter.ThenFunc(app.updateMovie)))
+	router.PATCH("/v1/movies/:id", app.wrap(moviesWriter.ThenFunc(app.updateMovie)))
+	router.DELETE("/v1/movies/:id", app.wrap(moviesWriter.ThenFunc(app.deleteMovie)))
+
+	// Movie revisions handlers, revision is saved on every movie change
+	router.GET("/v1/movies/:id/revisions", app.wrap(moviesWriter.ThenFunc(app.getMovieRevisions)))
+	router.GET("/v1/movies/:id/revisions/:rev", app.wrap(moviesWriter.ThenFunc(app.getMovieRevision)))
+	router.GET("/v1/movies/:id/revisions/:rev/diff", app.wrap(moviesWriter.ThenFunc(app.diffMovieRevisions)))
+	router.POST("/v1/movies/:id/revisions/:rev/restore", app.wrap(moviesWriter.ThenFunc(app.restoreMovieRevision)))
+
+	// Deleted movies are kept in trash until purged
+	router.GET("/v1/admin/movies/trash", app.wrap(moviesWriter.ThenFunc(app.getTrash)))
+	router.POST("/v1/admin/movies/:id/restore", app.wrap(moviesWriter.ThenFunc(app.restoreMovie)))
+
+	// Deprecated movies handlers, kept for compatibility with old clients
+	router.GET("/v1/movie/:id", app.wrap(
+		alice.New(app.deprecated("/v1/movies/:id")).ThenFunc(app.getOneMovie),
+	))
+	router.POST("/v1/admin/editmovie", app.wrap(
+		moviesWriter.Append(app.deprecated("/v1/movies")).ThenFunc(app.editMovie),
+	))
+	router.GET("/v1/admin/deletemovie/:id", app.wrap(
+		moviesWriter.Append(app.deprecated("/v1/movies/:id")).ThenFunc(app.legacyDeleteMovie),
+	))
 
 	// Genres collection handlers
 	router.HandlerFunc(http.MethodGet, "/v1/genres", app.getAllGenres)
+	router.HandlerFunc(http.MethodGet, "/v1/genres/:genre_id/movies", app.getAllMoviesByGenre)
+	router.POST("/v1/admin/genres", app.wrap(genresWriter.ThenFunc(app.createGenre)))
+	router.PUT("/v1/admin/genres/:id", app.wrap(genresWriter.ThenFunc(app.renameGenre)))
+	router.POST("/v1/admin/genres/:id/merge", app.wrap(genresWriter.ThenFunc(app.mergeGenre)))
+	router.DELETE("/v1/admin/genres/:id", app.wrap(genresWriter.ThenFunc(app.deleteGenre)))
+
+	// Users management handlers
+	router.PUT("/v1/admin/users/:id/role", app.wrap(usersManager.ThenFunc(app.setUserRole)))
+
+	// Audit log handlers
+	router.GET("/v1/admin/audit", app.wrap(auditReader.ThenFunc(app.getAuditLog)))
 
-	// CORS middleware is enabled by default for all routes
-	return app.enableCORS(router)
+	// CORS middleware is enabled by default for all routes, every request
+	// gets an ID
+	return app.enableCORS(app.requestID(router))
 }
@@ -5,18 +5,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/pascaldekloe/jwt"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// DB_USERS_MOCKUP_FILE is a path to file with users mockup data
-const DB_USERS_MOCKUP_FILE = "./data/user/users.json"
-
 // Credentials type constructs a map of user credentials to be checked
 // in signin API handler
 type Credentials struct {
@@ -35,77 +31,217 @@ func (app *application) Signin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	//
-	// Get user from mockup data / from DB here ...
-	//
+	foundUser, err := app.models.DB.GetUserByEmail(creds.Username)
+	if err != nil {
+		// If no user found at all, respond with invalid email provided
+		if errors.Is(err, models.ErrNoRecord) {
+			app.errorJSON(w, errors.New("unauthorized: invalid email"))
+			return
+		}
+
+		app.errorJSON(w, fmt.Errorf("unauthorized: unable to get user: %+v", err))
+		return
+	}
+
+	// Passwords are stored as bcrypt hashes
+	hashedPassword := foundUser.Password
 
-	// Mockup user from test file
-	// TODO: should be transferred to db managing
-	bu, err := ioutil.ReadFile(DB_USERS_MOCKUP_FILE)
+	// Main password check - comparing client password hash with db user hash
+	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(creds.Password))
 	if err != nil {
-		app.errorJSON(
-			w,
-			fmt.Errorf("unauthorized: unable to read users from file db: %+v", err),
-		)
+		app.errorJSON(w, errors.New("unauthorized: password is incorrect"))
 		return
 	}
 
-	var dbUsers []models.User
-	err = json.Unmarshal(bu, &dbUsers)
+	// Account status is reported only to whoever knows the password, so
+	// it can't be learned by email alone
+	if foundUser.Disabled {
+		app.errorJSON(w, errors.New("unauthorized: user is disabled"))
+		return
+	}
+
+	if !foundUser.Verified {
+		app.errorJSON(w, errors.New("unauthorized: email is not verified"))
+		return
+	}
+
+	// Signin starts a new refresh token family
+	app.issueTokens(w, foundUser, "")
+
+}
+
+// RefreshPayload type is a client payload of token refresh and signout APIs
+type RefreshPayload struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TokensResponse type is a client response of signin and token refresh
+// APIs. Response is the access token, named so for compatibility with
+// clients expecting only it.
+type TokensResponse struct {
+	Response     string    `json:"response"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	RefreshToken string    `json:"refresh_token"`
+}
+
+// refreshToken API handler exchanges refresh token for a new access token
+// and a new refresh token of the same family. Every refresh token may be
+// used only once: presenting it again revokes the whole family, so both
+// legitimate user and whoever stole the token have to sign in again.
+func (app *application) refreshToken(w http.ResponseWriter, r *http.Request) {
+	var payload RefreshPayload
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil || payload.RefreshToken == "" {
+		app.errorJSON(w, errors.New("unauthorized: cannot read refresh token"), http.StatusUnauthorized)
+		return
+	}
+
+	token, err := app.models.DB.UseRefreshToken(payload.RefreshToken)
 	if err != nil {
-		app.errorJSON(
-			w,
-			fmt.Errorf("unauthorized: unable to read users from file db: %+v", err),
-		)
+		switch {
+		case errors.Is(err, models.ErrNoRecord):
+			app.errorJSON(w, errors.New("unauthorized: invalid refresh token"), http.StatusUnauthorized)
+		case errors.Is(err, models.ErrTokenReused):
+			app.logger.Println("Refresh token reuse detected, token family revoked")
+			app.errorJSON(w, errors.New("unauthorized: refresh token reused"), http.StatusUnauthorized)
+		default:
+			app.errorJSON(w, err, http.StatusInternalServerError)
+		}
 		return
 	}
 
-	var foundUser models.User
-	for _, dbUser := range dbUsers {
-		if dbUser.Email == creds.Username {
-			foundUser = dbUser
+	if token.Expiry.Before(time.Now()) {
+		app.errorJSON(w, errors.New("unauthorized: refresh token expired"), http.StatusUnauthorized)
+		return
+	}
+
+	user, err := app.models.DB.GetUser(token.UserID)
+	if err != nil {
+		app.errorJSON(w, errors.New("unauthorized: unable to get user"), http.StatusUnauthorized)
+		return
+	}
+
+	if user.Disabled {
+		app.models.DB.RevokeRefreshFamily(token.Family)
+		app.errorJSON(w, errors.New("unauthorized: user is disabled"), http.StatusUnauthorized)
+		return
+	}
+
+	app.issueTokens(w, user, token.Family)
+}
+
+// signout API handler revokes access token of the request and, if provided,
+// the whole family of refresh token.
+func (app *application) signout(w http.ResponseWriter, r *http.Request) {
+	var payload RefreshPayload
+
+	// Refresh token is optional, so body may be empty
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		app.errorJSON(w, err)
+		return
+	}
+
+	claims := app.contextGetClaims(r)
+	if claims == nil || claims.ID == "" {
+		app.errorJSON(w, errors.New("unauthorized: token has no ID"), http.StatusUnauthorized)
+		return
+	}
+
+	err := app.models.DB.RevokeAccessToken(claims.ID, claims.Expires.Time())
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if payload.RefreshToken != "" {
+		token, err := app.models.DB.UseRefreshToken(payload.RefreshToken)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) && !errors.Is(err, models.ErrTokenReused) {
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// Only user's own refresh tokens can be revoked
+		if token != nil && token.UserID == app.contextGetUser(r).ID {
+			if err := app.models.DB.RevokeRefreshFamily(token.Family); err != nil {
+				app.errorJSON(w, err, http.StatusInternalServerError)
+				return
+			}
 		}
 	}
 
-	// If no user found at all, respond with invalid email provided
-	if foundUser.Email == "" {
-		app.errorJSON(w, errors.New("unauthorized: invalid email"))
+	ok := jsonResp{
+		OK: true,
+	}
+	if err := app.writeJSON(w, http.StatusOK, ok, "response"); err != nil {
+		app.errorJSON(w, err)
 		return
 	}
 
-	// Passwords inside users file db should also be encrypted
-	hashedPassword := foundUser.Password
+}
 
-	// Main password check - comparing client password hash with db user hash
-	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(creds.Password))
+// issueTokens function signs a new access token for user, creates a new
+// refresh token of family (new family if empty) and writes both into
+// response.
+func (app *application) issueTokens(w http.ResponseWriter, user *models.User, family string) {
+	jti, err := models.RandomID()
 	if err != nil {
-		app.errorJSON(w, errors.New("unauthorized: password is incorrect"))
+		app.errorJSON(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	// Constructing JWT claims. Token expiration time: 24 hours.
-	// Subject is user ID, not email. Issuers and audiences are provided
-	// in app's config
+	// Constructing JWT claims. Token expiration time is short, client should
+	// use refresh token to get a new one. Subject is user ID, not email,
+	// custom role claim is user's role. ID is used for token revocation.
+	// Issuers and audiences are provided in app's config
+	now := time.Now()
+	expires := now.Add(app.config.jwt.ttl)
+
 	var claims jwt.Claims
-	claims.Subject = fmt.Sprint(foundUser.ID)
-	claims.Issued = jwt.NewNumericTime(time.Now())
-	claims.NotBefore = jwt.NewNumericTime(time.Now())
-	claims.Expires = jwt.NewNumericTime(time.Now().Add(24 * time.Hour))
+	claims.Set = map[string]interface{}{"role": user.Role}
+	claims.ID = jti
+	claims.Subject = fmt.Sprint(user.ID)
+	claims.Issued = jwt.NewNumericTime(now)
+	claims.NotBefore = jwt.NewNumericTime(now)
+	claims.Expires = jwt.NewNumericTime(expires)
 	claims.Issuer = app.config.jwt.issuer
-	claims.Audiences = strings.Split(app.config.jwt.audiences, ",")
+	claims.Audiences = app.config.jwtAudiences()
 
-	// Sign claims by using JWT secret and get the new JWT in bytes
-	jwtBytes, err := claims.HMACSign(jwt.HS256, []byte(app.config.jwt.secret))
+	// Sign claims by using current signing key and get the new JWT in bytes
+	jwtBytes, err := app.keys.sign(&claims)
 	if err != nil {
 		app.errorJSON(w, errors.New("unauthorized: error in signing a new JWT"))
 		return
 	}
 
-	// Client response should contain JWT as string
-	err = app.writeJSON(w, http.StatusOK, string(jwtBytes), "response")
+	plaintext, refresh, err := models.NewRefreshToken(user.ID, family, app.config.jwt.refreshTTL)
 	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.models.DB.InsertRefreshToken(refresh); err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// Client response should contain JWT as string
+	resp := TokensResponse{
+		Response:     string(jwtBytes),
+		ExpiresAt:    expires,
+		RefreshToken: plaintext,
+	}
+	if err := app.writeJSON(w, http.StatusOK, resp); err != nil {
 		app.errorJSON(w, err)
 		return
 	}
+}
 
+// jwks API handler returns JSON Web Key Set of public keys, so other
+// services may verify tokens without holding any secret.
+func (app *application) jwks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write(app.keys.publicJWKS())
 }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"backend/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// signinTokens function signs user in and returns issued tokens.
+func (ta *testApp) signinTokens(t *testing.T, email, password string) TokensResponse {
+	t.Helper()
+
+	res := ta.signin(t, email, password)
+	checkResponse(t, res, http.StatusOK, "")
+
+	var tokens TokensResponse
+	decodeBody(t, res, &tokens)
+
+	return tokens
+}
+
+// refresh function exchanges refresh token for a new pair of tokens and
+// returns the response.
+func (ta *testApp) refresh(t *testing.T, token string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	return ta.request(t, http.MethodPost, "/v1/token/refresh", "", jsonBody(RefreshPayload{RefreshToken: token}), nil)
+}
+
+// bearer function returns Authorization header of access token.
+func bearer(token string) map[string]string {
+	return map[string]string{"Authorization": "Bearer " + token}
+}
+
+func TestRefreshToken(t *testing.T) {
+	ta := newTestApp(t)
+
+	stolen := ta.signinTokens(t, "editor@test.local", testPassword)
+	other := ta.signinTokens(t, "editor@test.local", testPassword)
+
+	res := ta.refresh(t, stolen.RefreshToken)
+	checkResponse(t, res, http.StatusOK, "")
+
+	var rotated TokensResponse
+	decodeBody(t, res, &rotated)
+	if rotated.Response == stolen.Response || rotated.RefreshToken == stolen.RefreshToken {
+		t.Fatal("tokens aren't rotated")
+	}
+
+	res = ta.request(t, http.MethodGet, "/v1/movies/1/revisions", "", "", bearer(rotated.Response))
+	checkResponse(t, res, http.StatusOK, "")
+
+	steps := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"unknown token", "invalid", http.StatusUnauthorized},
+		{"reused token", stolen.RefreshToken, http.StatusUnauthorized},
+		{"token of revoked family", rotated.RefreshToken, http.StatusUnauthorized},
+		{"token of other family", other.RefreshToken, http.StatusOK},
+	}
+
+	for _, step := range steps {
+		res := ta.refresh(t, step.token)
+		if res.Code != step.status {
+			t.Fatalf("%s: status %d, expected %d, body %s", step.name, res.Code, step.status, res.Body)
+		}
+	}
+}
+
+func TestSignout(t *testing.T) {
+	ta := newTestApp(t)
+
+	tokens := ta.signinTokens(t, "editor@test.local", testPassword)
+
+	res := ta.request(t, http.MethodPost, "/v1/signout", "", "", nil)
+	checkResponse(t, res, http.StatusUnauthorized, ErrCodeMissingToken)
+
+	res = ta.request(t, http.MethodPost, "/v1/signout", "", jsonBody(RefreshPayload{RefreshToken: tokens.RefreshToken}), bearer(tokens.Response))
+	checkResponse(t, res, http.StatusOK, "")
+
+	res = ta.request(t, http.MethodGet, "/v1/movies/1/revisions", "", "", bearer(tokens.Response))
+	checkResponse(t, res, http.StatusUnauthorized, ErrCodeTokenRevoked)
+
+	res = ta.refresh(t, tokens.RefreshToken)
+	checkResponse(t, res, http.StatusUnauthorized, "")
+
+	// Other sessions of user are kept
+	res = ta.request(t, http.MethodGet, "/v1/movies/1/revisions", models.RoleEditor, "", nil)
+	checkResponse(t, res, http.StatusOK, "")
+}
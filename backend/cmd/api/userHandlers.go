@@ -0,0 +1,345 @@
+package main
+
+import (
+	"backend/mailer"
+	"backend/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// Lifetime of email verification token
+	VERIFICATION_TOKEN_TTL = 24 * time.Hour
+	// Lifetime of password reset token
+	PASSWORD_RESET_TOKEN_TTL = time.Hour
+	// Cost of bcrypt password hashing
+	PASSWORD_HASH_COST = 12
+)
+
+// TokenPayload type is a client payload of verification and password reset
+// APIs. Password is required for password reset only.
+type TokenPayload struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// Signup API handler creates a new unverified user and sends email
+// verification token to user's email. Responds with 201 Created.
+func (app *application) Signup(w http.ResponseWriter, r *http.Request) {
+	var creds Credentials
+
+	err := json.NewDecoder(r.Body).Decode(&creds)
+	if err != nil {
+		app.errorJSON(w, errors.New("cannot read user credentials"))
+		return
+	}
+
+	addr, err := mail.ParseAddress(creds.Username)
+	if err != nil || addr.Address != creds.Username {
+		app.errorJSON(w, errors.New("invalid email"))
+		return
+	}
+
+	if err := validatePassword(creds.Password); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(creds.Password), PASSWORD_HASH_COST)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	user := models.User{
+		Email:    creds.Username,
+		Password: string(hash),
+	}
+
+	user.ID, err = app.models.DB.InsertUser(user)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			app.errorJSON(w, errors.New("user with this email already exists"), http.StatusConflict)
+			return
+		}
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	token, err := app.newUserToken(user.ID, VERIFICATION_TOKEN_TTL, models.ScopeVerification)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email",
+		Body: fmt.Sprintf(
+			"Welcome to Go Movies!\n\n"+
+				"Please confirm your email by following the link:\n%s/verify-email?token=%s\n\n"+
+				"Or use this token: %s\n\nThe token expires in %s.\n",
+			app.config.appURL, token, token, VERIFICATION_TOKEN_TTL,
+		),
+	})
+
+	ok := jsonResp{
+		OK:      true,
+		Message: "user created, check your email to verify it",
+	}
+	if err := app.writeJSON(w, http.StatusCreated, ok, "response"); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+}
+
+// verifyEmail API handler consumes email verification token and marks its
+// user as verified.
+func (app *application) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	var payload TokenPayload
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	userID, err := app.models.DB.UseUserToken(payload.Token, models.ScopeVerification)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.errorJSON(w, errors.New("invalid or expired token"))
+			return
+		}
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.models.DB.VerifyUser(userID); err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	ok := jsonResp{
+		OK:      true,
+		Message: "email verified",
+	}
+	if err := app.writeJSON(w, http.StatusOK, ok, "response"); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+}
+
+// forgotPassword API handler sends password reset token to user's email.
+// Always responds with 202 Accepted, so it can't be used to find out which
+// emails are registered.
+func (app *application) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	var creds Credentials
+
+	err := json.NewDecoder(r.Body).Decode(&creds)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	ok := jsonResp{
+		OK:      true,
+		Message: "if the email is registered, password reset instructions are sent to it",
+	}
+
+	user, err := app.models.DB.GetUserByEmail(creds.Username)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if user != nil && !user.Disabled {
+		// Only the latest requested token stays valid
+		if err := app.models.DB.DeleteUserTokens(user.ID, models.ScopePasswordReset); err != nil {
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		token, err := app.newUserToken(user.ID, PASSWORD_RESET_TOKEN_TTL, models.ScopePasswordReset)
+		if err != nil {
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		app.sendMail(mailer.Message{
+			To:      user.Email,
+			Subject: "Reset your password",
+			Body: fmt.Sprintf(
+				"To set a new password follow the link:\n%s/reset-password?token=%s\n\n"+
+					"Or use this token: %s\n\nThe token expires in %s. "+
+					"If you didn't request password reset, just ignore this message.\n",
+				app.config.appURL, token, token, PASSWORD_RESET_TOKEN_TTL,
+			),
+		})
+	}
+
+	if err := app.writeJSON(w, http.StatusAccepted, ok, "response"); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+}
+
+// resetPassword API handler consumes password reset token and sets a new
+// password of its user, revoking refresh tokens of all user's sessions.
+func (app *application) resetPassword(w http.ResponseWriter, r *http.Request) {
+	var payload TokenPayload
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	// Validate password before the token is consumed, so user may retry
+	if err := validatePassword(payload.Password); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	userID, err := app.models.DB.UseUserToken(payload.Token, models.ScopePasswordReset)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.errorJSON(w, errors.New("invalid or expired token"))
+			return
+		}
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(payload.Password), PASSWORD_HASH_COST)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.models.DB.UpdateUserPassword(userID, string(hash)); err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// Sessions signed in with the old password can't be refreshed anymore
+	if err := app.models.DB.RevokeUserRefreshFamilies(userID); err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// Receiving the token proves user owns the email as well
+	if err := app.models.DB.VerifyUser(userID); err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	ok := jsonResp{
+		OK:      true,
+		Message: "password updated",
+	}
+	if err := app.writeJSON(w, http.StatusOK, ok, "response"); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+}
+
+// RolePayload type is a client payload of user role API.
+type RolePayload struct {
+	Role string `json:"role"`
+}
+
+// setUserRole API handler changes role of user by its ID. New role takes
+// effect since user's next signin.
+func (app *application) setUserRole(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid ID parameter"))
+		return
+	}
+
+	var payload RolePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	if !models.ValidRole(payload.Role) {
+		app.errorJSON(w, fmt.Errorf(
+			"role must be one of: %s, %s, %s",
+			models.RoleViewer, models.RoleEditor, models.RoleAdmin,
+		))
+		return
+	}
+
+	if err := app.models.DB.SetUserRole(id, payload.Role); err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.errorJSON(w, errors.New("user not found"), http.StatusNotFound)
+			return
+		}
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.logger.Printf("User %d role set to %s by user %d", id, payload.Role, app.contextGetUser(r).ID)
+
+	ok := jsonResp{
+		OK: true,
+	}
+	if err := app.writeJSON(w, http.StatusOK, ok, "response"); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+}
+
+// newUserToken function creates and stores a new user token of scope,
+// returns its plaintext to be sent to user.
+func (app *application) newUserToken(userID int, ttl time.Duration, scope string) (string, error) {
+	plaintext, token, err := models.NewUserToken(userID, ttl, scope)
+	if err != nil {
+		return "", err
+	}
+
+	if err := app.models.DB.InsertUserToken(token); err != nil {
+		return "", err
+	}
+
+	return plaintext, nil
+}
+
+// sendMail function sends message in background, errors are only logged.
+func (app *application) sendMail(msg mailer.Message) {
+	app.background(func() {
+		if err := app.mailer.Send(msg); err != nil {
+			app.logger.Println(fmt.Errorf("failed to send email to %s: %+v", msg.To, err))
+		}
+	})
+}
+
+// validatePassword function checks password length. Upper limit is due to
+// bcrypt, which uses only first 72 bytes of password.
+func validatePassword(password string) error {
+	if len(password) < 8 {
+		return errors.New("password must be at least 8 characters long")
+	}
+
+	if len(password) > 72 {
+		return errors.New("password must not be longer than 72 bytes")
+	}
+
+	return nil
+}
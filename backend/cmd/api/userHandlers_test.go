@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSignup(t *testing.T) {
+	ta := newTestApp(t)
+
+	const email = "new@test.local"
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{
+			name:   "new user",
+			body:   jsonBody(map[string]string{"email": email, "password": testPassword}),
+			status: http.StatusCreated,
+		},
+		{
+			name:   "registered email",
+			body:   jsonBody(map[string]string{"email": email, "password": testPassword}),
+			status: http.StatusConflict,
+		},
+		{
+			name:   "invalid email",
+			body:   jsonBody(map[string]string{"email": "New <new@test.local>", "password": testPassword}),
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "short password",
+			body:   jsonBody(map[string]string{"email": "short@test.local", "password": "pa55"}),
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ta.request(t, http.MethodPost, "/v1/signup", "", tt.body, nil)
+			checkResponse(t, res, tt.status, "")
+		})
+	}
+
+	token := ta.mailToken(t, email)
+
+	res := ta.signin(t, email, testPassword)
+	checkResponse(t, res, http.StatusBadRequest, "")
+
+	steps := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"invalid token", "invalid", http.StatusBadRequest},
+		{"mailed token", token, http.StatusOK},
+		{"used token", token, http.StatusBadRequest},
+	}
+
+	for _, step := range steps {
+		res := ta.request(t, http.MethodPost, "/v1/users/verify", "", jsonBody(TokenPayload{Token: step.token}), nil)
+		if res.Code != step.status {
+			t.Fatalf("%s: status %d, expected %d, body %s", step.name, res.Code, step.status, res.Body)
+		}
+	}
+
+	res = ta.signin(t, email, testPassword)
+	checkResponse(t, res, http.StatusOK, "")
+}
+
+func TestPasswordReset(t *testing.T) {
+	ta := newTestApp(t)
+
+	const email = "viewer@test.local"
+	const password = "n3w-pa55word"
+
+	session := ta.signinTokens(t, email, testPassword)
+
+	res := ta.request(t, http.MethodPost, "/v1/password/forgot", "", `{"email":"unknown@test.local"}`, nil)
+	checkResponse(t, res, http.StatusAccepted, "")
+
+	res = ta.request(t, http.MethodPost, "/v1/password/forgot", "", jsonBody(map[string]string{"email": email}), nil)
+	checkResponse(t, res, http.StatusAccepted, "")
+
+	token := ta.mailToken(t, email)
+
+	steps := []struct {
+		name    string
+		payload TokenPayload
+		status  int
+	}{
+		{"short password", TokenPayload{Token: token, Password: "pa55"}, http.StatusBadRequest},
+		{"invalid token", TokenPayload{Token: "invalid", Password: password}, http.StatusBadRequest},
+		{"mailed token", TokenPayload{Token: token, Password: password}, http.StatusOK},
+		{"used token", TokenPayload{Token: token, Password: password}, http.StatusBadRequest},
+	}
+
+	for _, step := range steps {
+		res := ta.request(t, http.MethodPost, "/v1/password/reset", "", jsonBody(step.payload), nil)
+		if res.Code != step.status {
+			t.Fatalf("%s: status %d, expected %d, body %s", step.name, res.Code, step.status, res.Body)
+		}
+	}
+
+	res = ta.signin(t, email, testPassword)
+	checkResponse(t, res, http.StatusBadRequest, "")
+
+	res = ta.signin(t, email, password)
+	checkResponse(t, res, http.StatusOK, "")
+
+	// Sessions signed in with the old password can't be refreshed
+	res = ta.refresh(t, session.RefreshToken)
+	checkResponse(t, res, http.StatusUnauthorized, "")
+}
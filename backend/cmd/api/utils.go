@@ -1,10 +1,17 @@
 package main
 
 import (
+	"backend/models"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
 )
 
 // lookupEnv function returns env var or default value (if not set) as string.
@@ -45,6 +52,85 @@ func lookupEnvInt(key string, defaultValue ...int) int {
 	return 0
 }
 
+// lookupEnvBool function returns env var of bool type (e.g. "true", "1"),
+// passing from default value if not set or incorrect format.
+func lookupEnvBool(key string, defaultValue bool) bool {
+	if v, ok := os.LookupEnv(key); ok {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+
+	return defaultValue
+}
+
+// lookupEnvDuration function returns env var of time.Duration type (e.g.
+// "15m"), passing from default value if not set or incorrect format.
+func lookupEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if v, ok := os.LookupEnv(key); ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+
+	return defaultValue
+}
+
+// readIDParam function returns integer id parameter of request path.
+func readIDParam(r *http.Request) (int, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		return 0, errors.New("invalid ID parameter")
+	}
+
+	return id, nil
+}
+
+// ifMatch function reports whether If-Match header of request lists etag
+// or is "*", matching any current representation.
+func ifMatch(r *http.Request, etag string) bool {
+	for _, tag := range strings.Split(r.Header.Get("If-Match"), ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Maximum length of request ID accepted from client
+const MAX_REQUEST_ID_LENGTH = 128
+
+// validRequestID function reports whether request ID sent by client is
+// short and consists of safe characters only, so it may be logged as is.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > MAX_REQUEST_ID_LENGTH {
+		return false
+	}
+
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.:", c)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newRequestID function returns a new random request ID.
+func newRequestID() string {
+	id, err := models.RandomID()
+	if err != nil {
+		// Requests are still served, they just can't be told apart
+		return "unknown"
+	}
+
+	return id
+}
+
 // writeJSON function wraps json data with appropriate status code into
 // http response.
 func (app *application) writeJSON(w http.ResponseWriter, status int, data interface{}, wrap ...string) error {
@@ -73,21 +159,66 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data interf
 // Default status code: 400 Bad Request.
 // Use status argument to provide different status code.
 func (app *application) errorJSON(w http.ResponseWriter, err error, status ...int) {
+	app.errorCodeJSON(w, err, "", status...)
+}
+
+// errorCodeJSON function works as errorJSON, adding machine-readable error
+// code into http response, so clients don't have to parse messages.
+func (app *application) errorCodeJSON(w http.ResponseWriter, err error, code string, status ...int) {
 	statusCode := http.StatusBadRequest
 
 	if len(status) > 0 {
 		statusCode = status[0]
 	}
 
-	type jsonError struct {
-		StatusCode int    `json:"statusCode"`
-		Message    string `json:"message"`
-	}
+	app.writeError(w, statusCode, jsonError{
+		Code:    code,
+		Message: err.Error(),
+	})
+}
 
-	theError := jsonError{
-		StatusCode: statusCode,
-		Message:    err.Error(),
-	}
+// jsonError type is an error of http response. Fields holds error messages
+// of payload fields, if payload is invalid.
+type jsonError struct {
+	StatusCode int               `json:"statusCode"`
+	Code       string            `json:"code,omitempty"`
+	Message    string            `json:"message"`
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+// writeError function wraps error into http response with status code.
+func (app *application) writeError(w http.ResponseWriter, status int, theError jsonError) {
+	theError.StatusCode = status
 
-	app.writeJSON(w, statusCode, theError, "error")
+	app.writeJSON(w, status, theError, "error")
+}
+
+// background function runs fn in a separate goroutine, recovering and
+// logging its panic, if any. Use it for slow side work of request handlers
+// like sending emails.
+func (app *application) background(fn func()) {
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Println(fmt.Errorf("background task panic: %+v", err))
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// runPeriodically function runs job in background every interval, job
+// errors are only logged.
+func (app *application) runPeriodically(interval time.Duration, name string, job func() error) {
+	app.background(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := job(); err != nil {
+				app.logger.Println(fmt.Errorf("%s job failed: %+v", name, err))
+			}
+		}
+	})
 }
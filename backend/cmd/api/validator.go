@@ -0,0 +1,153 @@
+package main
+
+import (
+	"backend/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Format of movie release date in payloads
+	DATE_LAYOUT = "2006-01-02"
+	// Maximum length of movie title in characters
+	MAX_TITLE_LENGTH = 500
+	// Allowed range of movie rating
+	MIN_RATING = 0
+	MAX_RATING = 5
+)
+
+// validator type collects validation errors of payload fields, only the
+// first error of every field is kept.
+type validator struct {
+	Errors map[string]string
+}
+
+// newValidator function returns validator with no errors.
+func newValidator() *validator {
+	return &validator{Errors: make(map[string]string)}
+}
+
+// Valid function reports whether no errors are found.
+func (v *validator) Valid() bool {
+	return len(v.Errors) == 0
+}
+
+// AddError function adds error message of field, unless field already has
+// one.
+func (v *validator) AddError(field, message string) {
+	if _, ok := v.Errors[field]; !ok {
+		v.Errors[field] = message
+	}
+}
+
+// Check function adds error message of field if ok is false.
+func (v *validator) Check(ok bool, field, message string) {
+	if !ok {
+		v.AddError(field, message)
+	}
+}
+
+// failedValidation function responds with 422 Unprocessable Entity and
+// error messages by payload fields.
+func (app *application) failedValidation(w http.ResponseWriter, fields map[string]string) {
+	app.writeError(w, http.StatusUnprocessableEntity, jsonError{
+		Code:    "validation_failed",
+		Message: "invalid payload, see fields for details",
+		Fields:  fields,
+	})
+}
+
+// decodeJSON function decodes request payload into dst. Type mismatch of
+// payload field is reported as its validation error, other decoding errors
+// are returned.
+func decodeJSON(r *http.Request, dst interface{}, v *validator) error {
+	err := json.NewDecoder(r.Body).Decode(dst)
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		v.AddError(typeErr.Field, fmt.Sprintf("must be of %s type", jsonTypeName(typeErr.Type.Kind().String())))
+		return nil
+	}
+
+	return err
+}
+
+// jsonTypeName function returns JSON type name of Go kind.
+func jsonTypeName(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "float"):
+		return "number"
+	case kind == "slice":
+		return "array"
+	default:
+		return kind
+	}
+}
+
+// validateMovie function checks movie fields.
+func validateMovie(v *validator, movie *models.Movie) {
+	title := strings.TrimSpace(movie.Title)
+	v.Check(title != "", "title", "is required")
+	v.Check(len([]rune(title)) <= MAX_TITLE_LENGTH, "title", fmt.Sprintf("must not be longer than %d characters", MAX_TITLE_LENGTH))
+
+	v.Check(!movie.ReleaseDate.IsZero(), "release_date", "is required")
+
+	v.Check(movie.Runtime > 0, "runtime", "must be greater than zero")
+
+	v.Check(
+		movie.Rating >= MIN_RATING && movie.Rating <= MAX_RATING,
+		"rating",
+		fmt.Sprintf("must be between %d and %d", MIN_RATING, MAX_RATING),
+	)
+
+	v.Check(
+		movie.MPAARating == "" || models.ValidMPAARating(movie.MPAARating),
+		"mpaa_rating",
+		"must be one of "+strings.Join(models.MPAARatings, ", "),
+	)
+}
+
+// validateGenreIDs function checks that genre IDs are positive.
+func validateGenreIDs(v *validator, genreIDs []int) {
+	for _, id := range genreIDs {
+		if id < 1 {
+			v.AddError("genre_ids", "must contain positive genre IDs")
+			return
+		}
+	}
+}
+
+// parseDate function parses date of payload field, adding validation error
+// if it's not in DATE_LAYOUT format. Empty value is zero time.
+func parseDate(v *validator, field, value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+
+	date, err := time.Parse(DATE_LAYOUT, value)
+	if err != nil {
+		v.AddError(field, "must be a date in YYYY-MM-DD format")
+	}
+
+	return date
+}
+
+// parseInt function parses integer of payload string field, adding
+// validation error if it's not an integer. Empty value is zero.
+func parseInt(v *validator, field, value string) int {
+	if strings.TrimSpace(value) == "" {
+		return 0
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		v.AddError(field, "must be an integer")
+	}
+
+	return n
+}
@@ -0,0 +1,194 @@
+// Package fixtures loads movies, genres and their links from YAML or JSON
+// fixture files into any models store. Loading is idempotent: genres are
+// matched by name and movies by title and year, so existing records are
+// updated instead of duplicated. The same fixtures may be used to seed
+// development databases and to prepare stores in tests.
+package fixtures
+
+import (
+	"backend/models"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed sample.yaml
+var sample []byte
+
+// DATE_LAYOUT is a format of movie release date in fixture files
+const DATE_LAYOUT = "2006-01-02"
+
+// Fixtures type is the content of fixture file.
+type Fixtures struct {
+	Genres []Genre `yaml:"genres" json:"genres"`
+	Movies []Movie `yaml:"movies" json:"movies"`
+}
+
+// Genre type is a genre of fixture file, name is its natural key.
+type Genre struct {
+	Name string `yaml:"name" json:"name"`
+}
+
+// Movie type is a movie of fixture file, title and year are its natural
+// key. Genres are genre names, missing genres are created.
+type Movie struct {
+	Title       string   `yaml:"title" json:"title"`
+	Description string   `yaml:"description" json:"description"`
+	Year        int      `yaml:"year" json:"year"`
+	ReleaseDate string   `yaml:"release_date" json:"release_date"`
+	Runtime     int      `yaml:"runtime" json:"runtime"`
+	Rating      int      `yaml:"rating" json:"rating"`
+	MPAARating  string   `yaml:"mpaa_rating" json:"mpaa_rating"`
+	Genres      []string `yaml:"genres" json:"genres"`
+}
+
+// Result type counts records seeded by Seed.
+type Result struct {
+	Genres int
+	Movies int
+	Links  int
+}
+
+// Load function reads fixtures from file, format is picked by extension:
+// .json for JSON, .yaml or .yml for YAML.
+func Load(path string) (*Fixtures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := Parse(data, filepath.Ext(path))
+	if err != nil {
+		return nil, fmt.Errorf("invalid fixtures file %s: %+v", path, err)
+	}
+
+	return f, nil
+}
+
+// Sample function returns the bundled sample dataset.
+func Sample() (*Fixtures, error) {
+	return Parse(sample, ".yaml")
+}
+
+// Parse function decodes fixtures of format given as file extension.
+func Parse(data []byte, ext string) (*Fixtures, error) {
+	var f Fixtures
+
+	switch strings.ToLower(ext) {
+	case ".json":
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, err
+		}
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &f); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported fixtures format %q", ext)
+	}
+
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+// validate function checks that every record has its natural key and
+// release dates are valid.
+func (f *Fixtures) validate() error {
+	for i, g := range f.Genres {
+		if strings.TrimSpace(g.Name) == "" {
+			return fmt.Errorf("genre #%d has no name", i+1)
+		}
+	}
+
+	for i, m := range f.Movies {
+		if strings.TrimSpace(m.Title) == "" {
+			return fmt.Errorf("movie #%d has no title", i+1)
+		}
+
+		if m.ReleaseDate != "" {
+			if _, err := time.Parse(DATE_LAYOUT, m.ReleaseDate); err != nil {
+				return fmt.Errorf("movie %q has invalid release date, expected YYYY-MM-DD", m.Title)
+			}
+		}
+
+		for _, name := range m.Genres {
+			if strings.TrimSpace(name) == "" {
+				return fmt.Errorf("movie %q has empty genre name", m.Title)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Seed function upserts all genres, movies and movie genre links of
+// fixtures into store.
+func (f *Fixtures) Seed(store models.SeedStore) (Result, error) {
+	var result Result
+
+	// Genre IDs by names, for genres of fixtures and referenced by movies
+	genreIDs := make(map[string]int)
+	genreID := func(name string) (int, error) {
+		name = strings.TrimSpace(name)
+		if id, ok := genreIDs[name]; ok {
+			return id, nil
+		}
+
+		id, err := store.UpsertGenre(models.Genre{GenreName: name})
+		if err != nil {
+			return 0, fmt.Errorf("unable to seed genre %q: %+v", name, err)
+		}
+
+		genreIDs[name] = id
+		result.Genres++
+
+		return id, nil
+	}
+
+	for _, g := range f.Genres {
+		if _, err := genreID(g.Name); err != nil {
+			return result, err
+		}
+	}
+
+	for _, fm := range f.Movies {
+		movie := models.Movie{
+			Title:       strings.TrimSpace(fm.Title),
+			Description: fm.Description,
+			Year:        fm.Year,
+			Runtime:     fm.Runtime,
+			Rating:      fm.Rating,
+			MPAARating:  fm.MPAARating,
+		}
+		if fm.ReleaseDate != "" {
+			// Already validated on parse
+			movie.ReleaseDate, _ = time.Parse(DATE_LAYOUT, fm.ReleaseDate)
+		}
+
+		ids := make([]int, 0, len(fm.Genres))
+		for _, name := range fm.Genres {
+			id, err := genreID(name)
+			if err != nil {
+				return result, err
+			}
+			ids = append(ids, id)
+		}
+
+		if _, err := store.UpsertMovie(movie, ids); err != nil {
+			return result, fmt.Errorf("unable to seed movie %q: %+v", movie.Title, err)
+		}
+		result.Movies++
+		result.Links += len(ids)
+	}
+
+	return result, nil
+}
@@ -11,4 +11,6 @@ require (
 	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871
 )
 
-require github.com/graphql-go/graphql v0.8.0 // indirect
+require github.com/graphql-go/graphql v0.8.0
+
+require gopkg.in/yaml.v3 v3.0.1
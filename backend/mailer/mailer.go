@@ -0,0 +1,131 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message type describes plain text email message
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email messages to users
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// SMTPMailer sends messages through SMTP server using PLAIN authentication
+// (when username is provided)
+type SMTPMailer struct {
+	addr   string
+	auth   smtp.Auth
+	sender string
+	from   string
+}
+
+// NewSMTP returns mailer sending messages through SMTP server at host:port
+// on behalf of sender
+func NewSMTP(host string, port int, username, password, sender string) *SMTPMailer {
+	m := &SMTPMailer{
+		addr:   fmt.Sprintf("%s:%d", host, port),
+		sender: sender,
+		from:   sender,
+	}
+
+	// Envelope sender must be a bare address, without display name
+	if addr, err := mail.ParseAddress(sender); err == nil {
+		m.from = addr.Address
+	}
+
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return m
+}
+
+// Send sends message through SMTP server
+func (m *SMTPMailer) Send(msg Message) error {
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, compose(m.sender, msg))
+}
+
+// LogMailer does not send messages anywhere: it writes them into the log
+// and, if directory is provided, into .eml files there. Useful for local
+// development and testing.
+type LogMailer struct {
+	logger *log.Logger
+	dir    string
+	sender string
+}
+
+// NewLog returns mailer writing messages into logger and dir (if not empty)
+func NewLog(logger *log.Logger, dir, sender string) *LogMailer {
+	return &LogMailer{
+		logger: logger,
+		dir:    dir,
+		sender: sender,
+	}
+}
+
+// Send writes message into the log and message file
+func (m *LogMailer) Send(msg Message) error {
+	data := compose(m.sender, msg)
+
+	m.logger.Printf("[mailer] message to %s:\n%s", msg.To, data)
+
+	if m.dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), sanitize(msg.To))
+
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o644)
+}
+
+// compose builds RFC 5322 message of plain text email
+func compose(sender string, msg Message) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "From: %s\r\n", header(sender))
+	fmt.Fprintf(&b, "To: %s\r\n", header(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", header(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return b.Bytes()
+}
+
+// header removes line breaks from header value, so no extra headers can
+// be injected
+func header(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}
+
+// sanitize replaces all characters not safe for file names
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
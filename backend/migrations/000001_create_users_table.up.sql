@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS users (
+	id serial PRIMARY KEY,
+	email text NOT NULL UNIQUE,
+	password_hash text NOT NULL,
+	disabled boolean NOT NULL DEFAULT false,
+	created_at timestamp NOT NULL DEFAULT now(),
+	updated_at timestamp NOT NULL DEFAULT now()
+);
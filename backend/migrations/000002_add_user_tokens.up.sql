@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS verified boolean NOT NULL DEFAULT false;
+
+-- Accounts created before email verification was introduced are trusted
+UPDATE users SET verified = true;
+
+CREATE TABLE IF NOT EXISTS user_tokens (
+	hash bytea PRIMARY KEY,
+	user_id integer NOT NULL REFERENCES users ON DELETE CASCADE,
+	scope text NOT NULL,
+	expires_at timestamp NOT NULL,
+	created_at timestamp NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS user_tokens_user_id_scope_idx ON user_tokens (user_id, scope);
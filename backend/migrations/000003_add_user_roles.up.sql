@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role text NOT NULL DEFAULT 'viewer'
+	CHECK (role IN ('viewer', 'editor', 'admin'));
+
+-- Existing users stay viewers, operators are promoted explicitly by
+-- set-role command
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	hash bytea PRIMARY KEY,
+	user_id integer NOT NULL REFERENCES users ON DELETE CASCADE,
+	family text NOT NULL,
+	expires_at timestamp NOT NULL,
+	used_at timestamp,
+	revoked boolean NOT NULL DEFAULT false,
+	created_at timestamp NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_idx ON refresh_tokens (family);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+	jti text PRIMARY KEY,
+	expires_at timestamp NOT NULL
+);
@@ -0,0 +1,39 @@
+-- Catalogue tables existed before migrations were introduced, so they are
+-- created only if missing
+CREATE TABLE IF NOT EXISTS movies (
+	id serial PRIMARY KEY,
+	title text NOT NULL,
+	description text NOT NULL DEFAULT '',
+	year integer NOT NULL DEFAULT 0,
+	release_date date,
+	runtime integer NOT NULL DEFAULT 0,
+	rating integer NOT NULL DEFAULT 0,
+	mpaa_rating text NOT NULL DEFAULT '',
+	created_at timestamp NOT NULL DEFAULT now(),
+	updated_at timestamp NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS genres (
+	id serial PRIMARY KEY,
+	genre_name text NOT NULL UNIQUE,
+	created_at timestamp NOT NULL DEFAULT now(),
+	updated_at timestamp NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS movies_genres (
+	id serial PRIMARY KEY,
+	movie_id integer NOT NULL REFERENCES movies ON DELETE CASCADE,
+	genre_id integer NOT NULL REFERENCES genres,
+	created_at timestamp NOT NULL DEFAULT now(),
+	updated_at timestamp NOT NULL DEFAULT now(),
+	UNIQUE (movie_id, genre_id)
+);
+
+CREATE INDEX IF NOT EXISTS movies_genres_genre_id_idx ON movies_genres (genre_id);
+
+-- Same weighted document as the one of search query, so the query may use
+-- the index
+CREATE INDEX IF NOT EXISTS movies_search_idx ON movies USING GIN ((
+	setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+	setweight(to_tsvector('english', coalesce(description, '')), 'B')
+));
@@ -0,0 +1,3 @@
+-- Version is incremented by every update, so concurrent updates of the same
+-- movie version can be detected
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
@@ -0,0 +1,4 @@
+-- Deleted movies are kept in trash with their genre links until purged
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS deleted_at timestamp;
+
+CREATE INDEX IF NOT EXISTS movies_deleted_at_idx ON movies (deleted_at) WHERE deleted_at IS NOT NULL;
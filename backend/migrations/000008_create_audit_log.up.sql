@@ -0,0 +1,15 @@
+-- Entries are never updated, actor is kept even if user account is changed
+CREATE TABLE IF NOT EXISTS audit_log (
+	id bigserial PRIMARY KEY,
+	actor_id integer NOT NULL,
+	action text NOT NULL,
+	entity text NOT NULL,
+	entity_id integer NOT NULL,
+	changes jsonb NOT NULL DEFAULT '{}',
+	request_id text NOT NULL DEFAULT '',
+	created_at timestamp NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON audit_log (entity, entity_id);
+CREATE INDEX IF NOT EXISTS audit_log_actor_id_idx ON audit_log (actor_id);
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at);
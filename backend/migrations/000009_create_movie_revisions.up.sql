@@ -0,0 +1,11 @@
+-- Revision is the movie version the snapshot was taken of
+CREATE TABLE IF NOT EXISTS movie_revisions (
+	id bigserial PRIMARY KEY,
+	movie_id integer NOT NULL REFERENCES movies ON DELETE CASCADE,
+	revision integer NOT NULL,
+	movie jsonb NOT NULL,
+	genre_ids integer[] NOT NULL DEFAULT '{}',
+	actor_id integer,
+	created_at timestamp NOT NULL DEFAULT now(),
+	UNIQUE (movie_id, revision)
+);
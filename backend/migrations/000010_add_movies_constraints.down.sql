@@ -0,0 +1,3 @@
+-- Constraints are part of movies tables of migration 5 too, so they are
+-- kept, otherwise reverting to version 9 would leave tables unlike created
+-- by it
@@ -0,0 +1,70 @@
+-- Catalogue tables created before migrations may lack constraints of
+-- migration 5, which CREATE TABLE IF NOT EXISTS doesn't add to existing
+-- tables: purge of deleted movies relies on cascade of movie links, genre
+-- linking and renaming rely on uniqueness. Rows violating them are fixed
+-- first, so constraints may be added.
+
+-- Links of genres with duplicate names are moved to the first of them
+UPDATE
+	movies_genres mg
+SET
+	genre_id = d.first_id
+FROM
+	(SELECT id, min(id) OVER (PARTITION BY genre_name) AS first_id FROM genres) d
+WHERE
+	mg.genre_id = d.id
+	AND d.id <> d.first_id;
+
+DELETE FROM
+	genres g
+USING
+	genres f
+WHERE
+	g.genre_name = f.genre_name
+	AND g.id > f.id;
+
+DELETE FROM
+	movies_genres
+WHERE
+	movie_id NOT IN (SELECT id FROM movies)
+	OR genre_id NOT IN (SELECT id FROM genres);
+
+DELETE FROM
+	movies_genres mg
+USING
+	movies_genres f
+WHERE
+	mg.movie_id = f.movie_id
+	AND mg.genre_id = f.genre_id
+	AND mg.id > f.id;
+
+-- Foreign keys may exist under any name and without cascade, so all of them
+-- are replaced by known ones
+DO $$
+DECLARE
+	fk record;
+BEGIN
+	FOR fk IN
+		SELECT conname FROM pg_constraint
+		WHERE conrelid = 'movies_genres'::regclass AND contype = 'f'
+	LOOP
+		EXECUTE format('ALTER TABLE movies_genres DROP CONSTRAINT %I', fk.conname);
+	END LOOP;
+END
+$$;
+
+ALTER TABLE movies_genres
+	ADD CONSTRAINT movies_genres_movie_id_fkey
+	FOREIGN KEY (movie_id) REFERENCES movies ON DELETE CASCADE;
+
+ALTER TABLE movies_genres
+	ADD CONSTRAINT movies_genres_genre_id_fkey
+	FOREIGN KEY (genre_id) REFERENCES genres;
+
+ALTER TABLE movies_genres DROP CONSTRAINT IF EXISTS movies_genres_movie_id_genre_id_key;
+ALTER TABLE movies_genres
+	ADD CONSTRAINT movies_genres_movie_id_genre_id_key UNIQUE (movie_id, genre_id);
+
+ALTER TABLE genres DROP CONSTRAINT IF EXISTS genres_genre_name_key;
+ALTER TABLE genres
+	ADD CONSTRAINT genres_genre_name_key UNIQUE (genre_name);
@@ -0,0 +1,402 @@
+// Package migrations holds versioned SQL migrations of PostgreSQL store and
+// runs them. Migrations are embedded into the binary, every version is a
+// pair of files named <version>_<name>.up.sql and <version>_<name>.down.sql.
+// Applied versions are recorded in schema_migrations table.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// LOCK_KEY is a key of PostgreSQL advisory lock held while migrations run,
+// so concurrent deploys don't apply the same migration twice
+const LOCK_KEY = 7_104_152_623
+
+// fileName matches migration file names, e.g. 000001_create_users.up.sql
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration type is a single schema version with its up and down SQL.
+type Migration struct {
+	Version int64
+	Name    string
+	up      string
+	down    string
+}
+
+// Status type describes whether migration is applied and when.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator type applies and reverts embedded migrations on database.
+type Migrator struct {
+	db         *sql.DB
+	logger     *log.Logger
+	migrations []Migration
+}
+
+// New function returns migrator of embedded migrations on db.
+func New(db *sql.DB, logger *log.Logger) (*Migrator, error) {
+	migrations, err := load(files)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		logger:     logger,
+		migrations: migrations,
+	}, nil
+}
+
+// load function reads migrations of fsys sorted by version. Every version
+// must have up migration, down one is optional: migrations without it are
+// irreversible, e.g. the ones of tables existed before migrations.
+func load(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, name := range names {
+		match := fileName.FindStringSubmatch(name)
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", name)
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version: %s", name)
+		}
+
+		text, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has different names: %s, %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.up = string(text)
+		} else {
+			m.down = string(text)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Latest function returns the latest known version, 0 if there are no
+// migrations.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up function applies all pending migrations.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down function reverts the latest steps applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		var reverted []Migration
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			if _, ok := applied[m.migrations[i].Version]; ok {
+				reverted = append(reverted, m.migrations[i])
+			}
+		}
+
+		return m.revertAll(ctx, conn, reverted)
+	})
+}
+
+// To function migrates schema to version: reverts applied migrations newer
+// than version, then applies pending ones up to version.
+func (m *Migrator) To(ctx context.Context, version int64) error {
+	if version != 0 && m.find(version) == nil {
+		return fmt.Errorf("unknown migration version: %d", version)
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		var reverted []Migration
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mg := m.migrations[i]
+			if _, ok := applied[mg.Version]; ok && mg.Version > version {
+				reverted = append(reverted, mg)
+			}
+		}
+
+		if err := m.revertAll(ctx, conn, reverted); err != nil {
+			return err
+		}
+
+		for _, mg := range m.migrations {
+			if _, ok := applied[mg.Version]; !ok && mg.Version <= version {
+				if err := m.apply(ctx, conn, mg); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// Force function marks migrations up to version as applied and newer ones
+// as not applied without running them. Use it once for databases migrated
+// manually before migrations runner was introduced.
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	if version != 0 && m.find(version) == nil {
+		return fmt.Errorf("unknown migration version: %d", version)
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version > $1`, version); err != nil {
+			return err
+		}
+
+		for _, mg := range m.migrations {
+			if mg.Version > version {
+				break
+			}
+
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO
+					schema_migrations
+				(version, name, applied_at)
+				values
+				($1, $2, $3)
+				ON CONFLICT (version) DO NOTHING
+			`, mg.Version, mg.Name, time.Now())
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Commit()
+	})
+}
+
+// Status function returns all known migrations with their apply time, nil
+// for pending ones.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mg := range m.migrations {
+			status := Status{Migration: mg}
+			if at, ok := applied[mg.Version]; ok {
+				status.AppliedAt = &at
+			}
+			statuses = append(statuses, status)
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// find function returns migration of version, nil if there is no such one.
+func (m *Migrator) find(version int64) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+
+	return nil
+}
+
+// apply function runs up migration and records its version in a single
+// transaction.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mg Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, mg.up); err != nil {
+		return fmt.Errorf("migration %d_%s failed: %+v", mg.Version, mg.Name, err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO
+			schema_migrations
+		(version, name, applied_at)
+		values
+		($1, $2, $3)
+	`, mg.Version, mg.Name, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	m.logger.Printf("Applied migration %d_%s", mg.Version, mg.Name)
+
+	return nil
+}
+
+// revertAll function reverts migrations in order given. None of them is
+// reverted if any is irreversible, so schema isn't left half reverted.
+func (m *Migrator) revertAll(ctx context.Context, conn *sql.Conn, migrations []Migration) error {
+	for _, mg := range migrations {
+		if mg.down == "" {
+			return fmt.Errorf("migration %d_%s is irreversible", mg.Version, mg.Name)
+		}
+	}
+
+	for _, mg := range migrations {
+		if err := m.revert(ctx, conn, mg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// revert function runs down migration and removes its version record in a
+// single transaction.
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, mg Migration) error {
+	if mg.down == "" {
+		return fmt.Errorf("migration %d_%s is irreversible", mg.Version, mg.Name)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, mg.down); err != nil {
+		return fmt.Errorf("migration %d_%s revert failed: %+v", mg.Version, mg.Name, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, mg.Version); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	m.logger.Printf("Reverted migration %d_%s", mg.Version, mg.Name)
+
+	return nil
+}
+
+// withLock function runs fn on a single connection holding migrations
+// advisory lock. Other migrators wait until the lock is released, so they
+// see migrations applied by the first one.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	// Advisory locks belong to session, so lock, migrations and unlock must
+	// share the same connection
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, LOCK_KEY); err != nil {
+		return fmt.Errorf("unable to acquire migrations lock: %+v", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, LOCK_KEY)
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version bigint PRIMARY KEY,
+			name text NOT NULL,
+			applied_at timestamp NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// appliedVersions function returns apply time of applied migrations by
+// their versions.
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+
+	return applied, rows.Err()
+}
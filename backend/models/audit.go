@@ -0,0 +1,368 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Actions of audit log entries
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditMerge   = "merge"
+	AuditPurge   = "purge"
+)
+
+// Entities of audit log entries
+const (
+	EntityMovie = "movie"
+	EntityGenre = "genre"
+)
+
+// Actor type identifies the user changing catalogue and the request the
+// change is made by
+type Actor struct {
+	UserID    int
+	RequestID string
+}
+
+// SYSTEM_ACTOR_ID is an actor ID of changes made by background jobs and
+// commands rather than users, user IDs start from 1
+const SYSTEM_ACTOR_ID = 0
+
+// SystemActor function returns actor of changes made by job, job name is
+// recorded as request ID of its audit entries.
+func SystemActor(job string) Actor {
+	return Actor{UserID: SYSTEM_ACTOR_ID, RequestID: job}
+}
+
+// AuditChange type is a value of changed field before and after the change,
+// nil if field didn't exist
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditEntry type describes one change of catalogue entity
+type AuditEntry struct {
+	ID        int                    `json:"id"`
+	ActorID   int                    `json:"actor_id"`
+	Action    string                 `json:"action"`
+	Entity    string                 `json:"entity"`
+	EntityID  int                    `json:"entity_id"`
+	Changes   map[string]AuditChange `json:"changes"`
+	RequestID string                 `json:"request_id"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// AuditFilter type describes filtering and pagination options of audit log
+// query. Zero value lists all entries, the most recent first.
+type AuditFilter struct {
+	Entity   string
+	EntityID *int
+	ActorID  *int
+	From     *time.Time
+	To       *time.Time
+	Limit    int
+	Offset   int
+}
+
+// movieSnapshot type is the audited state of movie, genres are listed by
+// IDs since link IDs change on every genres update
+type movieSnapshot struct {
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Year        int        `json:"year"`
+	ReleaseDate time.Time  `json:"release_date"`
+	Runtime     int        `json:"runtime"`
+	Rating      int        `json:"rating"`
+	MPAARating  string     `json:"mpaa_rating"`
+	Version     int        `json:"version"`
+	DeletedAt   *time.Time `json:"deleted_at"`
+	GenreIDs    []int64    `json:"genre_ids"`
+}
+
+// genreSnapshot type is the audited state of genre
+type genreSnapshot struct {
+	GenreName string `json:"genre_name"`
+}
+
+// snapshot returns JSON fields of v, so states of any entity are compared
+// the same way they are rendered
+func snapshot(v interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+
+	b, err := json.Marshal(v)
+	if err == nil {
+		json.Unmarshal(b, &fields)
+	}
+
+	return fields
+}
+
+// snapshotMovie returns audited state of movie linked with genres
+func snapshotMovie(movie Movie, genreIDs []int64) map[string]interface{} {
+	if genreIDs == nil {
+		genreIDs = []int64{}
+	}
+
+	return snapshot(movieSnapshot{
+		Title:       movie.Title,
+		Description: movie.Description,
+		Year:        movie.Year,
+		ReleaseDate: movie.ReleaseDate,
+		Runtime:     movie.Runtime,
+		Rating:      movie.Rating,
+		MPAARating:  movie.MPAARating,
+		Version:     movie.Version,
+		DeletedAt:   movie.DeletedAt,
+		GenreIDs:    genreIDs,
+	})
+}
+
+// snapshotGenre returns audited state of genre
+func snapshotGenre(genre Genre) map[string]interface{} {
+	return snapshot(genreSnapshot{GenreName: genre.GenreName})
+}
+
+// mergedState returns audited state of genre merged into target genre
+func mergedState(targetID int) map[string]interface{} {
+	return snapshot(map[string]int{"merged_into": targetID})
+}
+
+// diffSnapshots returns fields which differ between entity states, nil
+// state stands for entity which doesn't exist
+func diffSnapshots(before, after map[string]interface{}) map[string]AuditChange {
+	changes := make(map[string]AuditChange)
+
+	for field, value := range before {
+		if !reflect.DeepEqual(value, after[field]) {
+			changes[field] = AuditChange{Before: value, After: after[field]}
+		}
+	}
+	for field, value := range after {
+		if _, ok := before[field]; !ok && value != nil {
+			changes[field] = AuditChange{After: value}
+		}
+	}
+
+	return changes
+}
+
+// newAuditEntry returns audit entry of actor's change, or nil if there is
+// no actor to audit
+func newAuditEntry(actor *Actor, action, entity string, id int, before, after map[string]interface{}) *AuditEntry {
+	if actor == nil {
+		return nil
+	}
+
+	return &AuditEntry{
+		ActorID:   actor.UserID,
+		Action:    action,
+		Entity:    entity,
+		EntityID:  id,
+		Changes:   diffSnapshots(before, after),
+		RequestID: actor.RequestID,
+		CreatedAt: time.Now(),
+	}
+}
+
+// WithActor returns store writing audit entries of all catalogue changes on
+// behalf of actor. It shares database pool with m.
+func (m *DBModel) WithActor(actor Actor) Store {
+	audited := *m
+	audited.actor = &actor
+
+	return &audited
+}
+
+// audit writes audit entry of change made by tx, if store has an actor
+func (m *DBModel) audit(ctx context.Context, tx *sql.Tx, action, entity string, id int, before, after map[string]interface{}) error {
+	entry := newAuditEntry(m.actor, action, entity, id, before, after)
+	if entry == nil {
+		return nil
+	}
+
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, m.Queries.InsertAuditEntry,
+		entry.ActorID,
+		entry.Action,
+		entry.Entity,
+		entry.EntityID,
+		changes,
+		entry.RequestID,
+		entry.CreatedAt,
+	)
+
+	return err
+}
+
+// movieState returns audited state of movie read and locked by tx, or nil
+// if store has no actor. Movies in trash are read as well.
+func (m *DBModel) movieState(ctx context.Context, tx *sql.Tx, id int) (map[string]interface{}, error) {
+	if m.actor == nil {
+		return nil, nil
+	}
+
+	var movie Movie
+	var genreIDs []int64
+	err := tx.QueryRowContext(ctx, m.Queries.GetMovieSnapshot, id).Scan(
+		&movie.Title,
+		&movie.Description,
+		&movie.Year,
+		&movie.ReleaseDate,
+		&movie.Runtime,
+		&movie.Rating,
+		&movie.MPAARating,
+		&movie.Version,
+		&movie.DeletedAt,
+		pq.Array(&genreIDs),
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return snapshotMovie(movie, genreIDs), nil
+}
+
+// genreState returns audited state of genre read and locked by tx, or nil
+// if store has no actor
+func (m *DBModel) genreState(ctx context.Context, tx *sql.Tx, id int) (map[string]interface{}, error) {
+	if m.actor == nil {
+		return nil, nil
+	}
+
+	var genre Genre
+	err := tx.QueryRowContext(ctx, m.Queries.GetGenreSnapshot, id).Scan(&genre.GenreName)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return snapshotGenre(genre), nil
+}
+
+// AuditLog returns audit entries matching filter, the most recent first,
+// and pagination metadata
+func (m *DBModel) AuditLog(filter AuditFilter) ([]*AuditEntry, Metadata, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	meta := Metadata{Limit: filter.Limit, Offset: filter.Offset}
+
+	where, args := filter.where()
+	err := m.DB.QueryRowContext(ctx, fmt.Sprintf(m.Queries.CountAuditEntries, where), args...).Scan(&meta.Total)
+	if err != nil {
+		return nil, meta, err
+	}
+
+	var page string
+	if filter.Limit > 0 {
+		page = fmt.Sprintf("LIMIT %d", filter.Limit)
+	}
+	if filter.Offset > 0 {
+		page += fmt.Sprintf(" OFFSET %d", filter.Offset)
+	}
+
+	rows, err := m.DB.QueryContext(ctx, fmt.Sprintf(m.Queries.GetAuditEntries, where, page), args...)
+	if err != nil {
+		return nil, meta, err
+	}
+	defer rows.Close()
+
+	entries := []*AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var changes []byte
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.ActorID,
+			&entry.Action,
+			&entry.Entity,
+			&entry.EntityID,
+			&changes,
+			&entry.RequestID,
+			&entry.CreatedAt,
+		); err != nil {
+			return nil, meta, err
+		}
+
+		if err := json.Unmarshal(changes, &entry.Changes); err != nil {
+			return nil, meta, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	return entries, meta, rows.Err()
+}
+
+// where builds SQL conditions of filter with values of placeholders
+func (f AuditFilter) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if f.Entity != "" {
+		conds = append(conds, "entity = "+arg(f.Entity))
+	}
+	if f.EntityID != nil {
+		conds = append(conds, "entity_id = "+arg(*f.EntityID))
+	}
+	if f.ActorID != nil {
+		conds = append(conds, "actor_id = "+arg(*f.ActorID))
+	}
+	if f.From != nil {
+		conds = append(conds, "created_at >= "+arg(*f.From))
+	}
+	if f.To != nil {
+		conds = append(conds, "created_at < "+arg(*f.To))
+	}
+
+	if len(conds) == 0 {
+		return "", args
+	}
+
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// matches reports whether audit entry matches filter
+func (f AuditFilter) matches(entry *AuditEntry) bool {
+	switch {
+	case f.Entity != "" && entry.Entity != f.Entity:
+		return false
+	case f.EntityID != nil && entry.EntityID != *f.EntityID:
+		return false
+	case f.ActorID != nil && entry.ActorID != *f.ActorID:
+		return false
+	case f.From != nil && entry.CreatedAt.Before(*f.From):
+		return false
+	case f.To != nil && !entry.CreatedAt.Before(*f.To):
+		return false
+	}
+
+	return true
+}
@@ -2,8 +2,12 @@ package models
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 // Get controller returns one movie and error, if any
@@ -37,8 +41,12 @@ func (m *DBModel) Get(id int) (*Movie, error) {
 		&movie.MPAARating,
 		&movie.CreatedAt,
 		&movie.UpdatedAt,
+		&movie.Version,
 	)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
 		return nil, err
 	}
 
@@ -55,7 +63,10 @@ func (m *DBModel) Get(id int) (*Movie, error) {
 
 	genreQuery := m.Queries.GetGenresByMovie
 
-	rows, _ := m.DB.QueryContext(ctx, genreQuery, id)
+	rows, err := m.DB.QueryContext(ctx, genreQuery, id)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
 	genres := make(map[int]string)
@@ -73,6 +84,10 @@ func (m *DBModel) Get(id int) (*Movie, error) {
 		genres[mg.ID] = mg.Genre.GenreName
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
 	movie.MovieGenre = genres
 
 	return &movie, nil
@@ -121,48 +136,206 @@ func (m *DBModel) All(genre ...int) ([]*Movie, error) {
 			&movie.MPAARating,
 			&movie.CreatedAt,
 			&movie.UpdatedAt,
+			&movie.Version,
 		); err != nil {
 			return nil, err
 		}
 
-		// get the genres, if any
-		// genreQuery := `
-		// 	SELECT
-		// 		mg.id, mg.movie_id, mg.genre_id, g.genre_name
-		// 	FROM
-		// 		movies_genres mg
-		// 		LEFT JOIN genres g ON (g.id = mg.genre_id)
-		// 	WHERE
-		// 		mg.movie_id = $1
-		// `
-
-		genreQuery := m.Queries.GetGenresByMovie
-
-		genreRows, _ := m.DB.QueryContext(ctx, genreQuery, movie.ID)
-
-		genres := make(map[int]string)
-		for genreRows.Next() {
-			var mg MovieGenre
-			if err := genreRows.Scan(
-				&mg.ID,
-				&mg.MovieID,
-				&mg.GenreID,
-				&mg.Genre.GenreName,
-			); err != nil {
-				return nil, err
-			}
-
-			genres[mg.ID] = mg.Genre.GenreName
-		}
+		movies = append(movies, &movie)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-		genreRows.Close()
+	// get the genres of all movies found by one batched query
+	if err := m.attachGenres(ctx, movies); err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
+
+// List returns one page of movies matching filter and pagination metadata.
+// Cursor takes precedence over offset when both are provided.
+func (m *DBModel) List(filter MovieFilter) ([]*Movie, Metadata, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	meta := Metadata{Limit: filter.Limit, Offset: filter.Offset}
 
-		movie.MovieGenre = genres
+	c, err := filter.decodeCursor()
+	if err != nil {
+		return nil, meta, err
+	}
+
+	// Total count ignores pagination, only filters are applied
+	where, args := filter.where(nil, nil)
+	err = m.DB.QueryRowContext(ctx, fmt.Sprintf(m.Queries.CountMovies, where), args...).Scan(&meta.Total)
+	if err != nil {
+		return nil, meta, err
+	}
+
+	where, args = filter.where(nil, c)
+
+	var page string
+	if filter.Limit > 0 {
+		page = fmt.Sprintf("LIMIT %d", filter.Limit)
+	}
+	if c == nil && filter.Offset > 0 {
+		page += fmt.Sprintf(" OFFSET %d", filter.Offset)
+	}
+
+	query := fmt.Sprintf(m.Queries.ListMovies, where, filter.orderBy(), page)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, meta, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+	for rows.Next() {
+		var movie Movie
+		if err := rows.Scan(
+			&movie.ID,
+			&movie.Title,
+			&movie.Description,
+			&movie.Year,
+			&movie.ReleaseDate,
+			&movie.Runtime,
+			&movie.Rating,
+			&movie.MPAARating,
+			&movie.CreatedAt,
+			&movie.UpdatedAt,
+			&movie.Version,
+		); err != nil {
+			return nil, meta, err
+		}
 
 		movies = append(movies, &movie)
 	}
 
-	return movies, nil
+	if err := rows.Err(); err != nil {
+		return nil, meta, err
+	}
+
+	if err := m.attachGenres(ctx, movies); err != nil {
+		return nil, meta, err
+	}
+
+	if filter.Limit > 0 && len(movies) == filter.Limit {
+		meta.NextCursor = filter.nextCursor(movies[len(movies)-1])
+	}
+
+	return movies, meta, nil
+}
+
+// Search returns up to limit movies matching full-text query, ordered by
+// rank. Every word of query is matched as a prefix.
+func (m *DBModel) Search(query string, limit int) ([]*SearchResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tsquery := prefixTSQuery(query)
+	if tsquery == "" {
+		return []*SearchResult{}, nil
+	}
+
+	rows, err := m.DB.QueryContext(ctx, m.Queries.SearchMovies, tsquery, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*SearchResult{}
+	movies := []*Movie{}
+	for rows.Next() {
+		var res SearchResult
+		if err := rows.Scan(
+			&res.ID,
+			&res.Title,
+			&res.Description,
+			&res.Year,
+			&res.ReleaseDate,
+			&res.Runtime,
+			&res.Rating,
+			&res.MPAARating,
+			&res.CreatedAt,
+			&res.UpdatedAt,
+			&res.Version,
+			&res.Rank,
+			&res.TitleHighlight,
+			&res.Snippet,
+		); err != nil {
+			return nil, err
+		}
+
+		results = append(results, &res)
+		movies = append(movies, &res.Movie)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := m.attachGenres(ctx, movies); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// attachGenres populates genres of all provided movies, fetching them by one
+// query instead of querying genres per each movie
+func (m *DBModel) attachGenres(ctx context.Context, movies []*Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(movies))
+	byID := make(map[int]*Movie, len(movies))
+	for _, movie := range movies {
+		movie.MovieGenre = make(map[int]string)
+		ids = append(ids, int64(movie.ID))
+		byID[movie.ID] = movie
+	}
+
+	// query := `
+	// 	SELECT
+	// 		mg.id, mg.movie_id, mg.genre_id, g.genre_name
+	// 	FROM
+	// 		movies_genres mg
+	// 		LEFT JOIN genres g ON (g.id = mg.genre_id)
+	// 	WHERE
+	// 		mg.movie_id = ANY($1)
+	// `
+
+	query := m.Queries.GetGenresByMovies
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mg MovieGenre
+		if err := rows.Scan(
+			&mg.ID,
+			&mg.MovieID,
+			&mg.GenreID,
+			&mg.Genre.GenreName,
+		); err != nil {
+			return err
+		}
+
+		if movie, ok := byID[mg.MovieID]; ok {
+			movie.MovieGenre[mg.ID] = mg.Genre.GenreName
+		}
+	}
+
+	return rows.Err()
 }
 
 func (m *DBModel) GenresAll() ([]*Genre, error) {
@@ -204,7 +377,10 @@ func (m *DBModel) GenresAll() ([]*Genre, error) {
 	return genres, nil
 }
 
-func (m *DBModel) InsertMovie(movie Movie) error {
+// InsertMovie creates a new movie linked with genres of genreIDs in a
+// single transaction, saves its first revision and returns its ID. Returns
+// ErrUnknownGenre if any of genres doesn't exist.
+func (m *DBModel) InsertMovie(movie Movie, genreIDs []int) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -214,11 +390,18 @@ func (m *DBModel) InsertMovie(movie Movie) error {
 	// 	(title, description, year, release_date, runtime, rating, mpaa_rating, created_at, updated_at)
 	// 	values
 	// 	($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	// 	RETURNING id
 	// `
 
 	stmt := m.Queries.InsertMovie
 
-	_, err := m.DB.ExecContext(ctx, stmt,
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, stmt,
 		movie.Title,
 		movie.Description,
 		movie.Year,
@@ -228,15 +411,41 @@ func (m *DBModel) InsertMovie(movie Movie) error {
 		movie.MPAARating,
 		movie.CreatedAt,
 		movie.UpdatedAt,
-	)
+	).Scan(&movie.ID)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	if err := m.setMovieGenres(ctx, tx, movie.ID, genreIDs); err != nil {
+		return 0, err
+	}
+
+	if err := m.saveRevision(ctx, tx, movie.ID, m.actor); err != nil {
+		return 0, err
+	}
+
+	after, err := m.movieState(ctx, tx, movie.ID)
+	if err != nil {
+		return 0, err
+	}
+	if err := m.audit(ctx, tx, AuditCreate, EntityMovie, movie.ID, nil, after); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return movie.ID, nil
 }
 
-func (m *DBModel) UpdateMovie(movie Movie) error {
+// UpdateMovie updates movie fields and, unless genreIDs is nil, replaces
+// its genres in a single transaction. Movie is updated only if its version
+// is still movie.Version, the version is incremented then and revision of
+// the updated movie is saved. Returns
+// ErrNoRecord if there is no such movie, ErrEditConflict if its version
+// differs, ErrUnknownGenre if any of genres doesn't exist.
+func (m *DBModel) UpdateMovie(movie Movie, genreIDs []int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -246,14 +455,31 @@ func (m *DBModel) UpdateMovie(movie Movie) error {
 	// 	SET
 	// 		title = $1, description = $2, year = $3,
 	// 		release_date = $4, runtime = $5, rating = $6,
-	// 		mpaa_rating = $7, updated_at = $8
+	// 		mpaa_rating = $7, updated_at = $8, version = version + 1
 	// 	WHERE
-	// 		id = $9
+	// 		id = $9 AND version = $10
 	// `
 
 	stmt := m.Queries.UpdateMovie
 
-	_, err := m.DB.ExecContext(ctx, stmt,
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := m.movieState(ctx, tx, movie.ID)
+	if err != nil {
+		return err
+	}
+
+	// Movies created before revisions were introduced get their first
+	// revision, author of which is unknown
+	if err := m.saveRevision(ctx, tx, movie.ID, nil); err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, stmt,
 		movie.Title,
 		movie.Description,
 		movie.Year,
@@ -263,31 +489,154 @@ func (m *DBModel) UpdateMovie(movie Movie) error {
 		movie.MPAARating,
 		movie.UpdatedAt,
 		movie.ID,
+		movie.Version,
 	)
 	if err != nil {
 		return err
 	}
 
+	if err := expectAffected(res); err != nil {
+		return m.updateConflict(ctx, tx, movie.ID)
+	}
+
+	if genreIDs != nil {
+		if err := m.setMovieGenres(ctx, tx, movie.ID, genreIDs); err != nil {
+			return err
+		}
+	}
+
+	if err := m.saveRevision(ctx, tx, movie.ID, m.actor); err != nil {
+		return err
+	}
+
+	after, err := m.movieState(ctx, tx, movie.ID)
+	if err != nil {
+		return err
+	}
+	if err := m.audit(ctx, tx, AuditUpdate, EntityMovie, movie.ID, before, after); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updateConflict tells apart missing movie from the one with another
+// version, when conditional update changes nothing. Returns ErrNoRecord or
+// ErrEditConflict.
+func (m *DBModel) updateConflict(ctx context.Context, tx *sql.Tx, id int) error {
+	var version int
+	err := tx.QueryRowContext(ctx, m.Queries.GetMovieVersion, id).Scan(&version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	return ErrEditConflict
+}
+
+// setMovieGenres links movie with genres of genreIDs only: links to other
+// genres are removed, missing ones are created. Returns ErrUnknownGenre if
+// any of genres doesn't exist.
+func (m *DBModel) setMovieGenres(ctx context.Context, tx *sql.Tx, movieID int, genreIDs []int) error {
+	ids := uniqueIDs(genreIDs)
+
+	rows, err := tx.QueryContext(ctx, m.Queries.GetGenreIDs, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	found := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		found[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if err := checkGenresFound(ids, found); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, m.Queries.DeleteMovieGenresExcept, movieID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, id := range ids {
+		if _, err := tx.ExecContext(ctx, m.Queries.LinkMovieGenre, movieID, id, now); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// DeleteMovie moves movie to trash, keeping its genre links, returns
+// ErrNoRecord if there is no such movie
 func (m *DBModel) DeleteMovie(id int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	// stmt := `
-	// 	DELETE FROM
+	// 	UPDATE
 	// 		movies
+	// 	SET
+	// 		deleted_at = $2
 	// 	WHERE
-	// 		id = $1
+	// 		id = $1 AND deleted_at IS NULL
 	// `
 
 	stmt := m.Queries.DeleteMovie
 
-	_, err := m.DB.ExecContext(ctx, stmt, id)
+	return m.changeMovie(ctx, AuditDelete, id, stmt, id, time.Now())
+}
+
+// changeMovie executes statement changing movie by its ID in a transaction
+// together with writing audit entry of action. Returns ErrNoRecord if
+// nothing is changed.
+func (m *DBModel) changeMovie(ctx context.Context, action string, id int, stmt string, args ...interface{}) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	return nil
+	before, err := m.movieState(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+
+	if err := expectAffected(res); err != nil {
+		return err
+	}
+
+	// Restored movie gets a new version, moving one to trash doesn't
+	if action == AuditRestore {
+		if err := m.saveRevision(ctx, tx, id, m.actor); err != nil {
+			return err
+		}
+	}
+
+	after, err := m.movieState(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if err := m.audit(ctx, tx, action, EntityMovie, id, before, after); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// benchMovies is a number of movies genres are attached to by benchmarks
+const benchMovies = 100
+
+// benchDB function opens database of TEST_DSN env var and makes sure it
+// has benchMovies movies with genres. Benchmarks are skipped if it's not
+// set. The database must be a disposable one with migrations applied.
+func benchDB(b *testing.B) (*DBModel, []*Movie) {
+	dsn := os.Getenv("TEST_DSN")
+	if dsn == "" {
+		b.Skip("TEST_DSN is not set, PostgreSQL benchmarks are skipped")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close() })
+
+	m := NewModels(db).DB.(*DBModel)
+
+	genreIDs := make([]int, 0, 3)
+	for i := 0; i < cap(genreIDs); i++ {
+		id, err := m.UpsertGenre(Genre{GenreName: fmt.Sprintf("Bench genre %d", i)})
+		if err != nil {
+			b.Fatal(err)
+		}
+		genreIDs = append(genreIDs, id)
+	}
+
+	movies := make([]*Movie, 0, benchMovies)
+	for i := 0; i < benchMovies; i++ {
+		movie := Movie{
+			Title:       fmt.Sprintf("Bench movie %d", i),
+			Year:        2000,
+			ReleaseDate: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+			Runtime:     90,
+		}
+
+		id, err := m.UpsertMovie(movie, genreIDs)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		movie.ID = id
+		movies = append(movies, &movie)
+	}
+
+	return m, movies
+}
+
+// attachGenresPerMovie function attaches genres to movies by one query per
+// movie, as All did before genres were batched.
+func attachGenresPerMovie(ctx context.Context, m *DBModel, movies []*Movie) error {
+	for _, movie := range movies {
+		rows, err := m.DB.QueryContext(ctx, m.Queries.GetGenresByMovie, movie.ID)
+		if err != nil {
+			return err
+		}
+
+		movie.MovieGenre = make(map[int]string)
+		for rows.Next() {
+			var mg MovieGenre
+			if err := rows.Scan(&mg.ID, &mg.MovieID, &mg.GenreID, &mg.Genre.GenreName); err != nil {
+				rows.Close()
+				return err
+			}
+			movie.MovieGenre[mg.ID] = mg.Genre.GenreName
+		}
+
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func BenchmarkAttachGenresPerMovie(b *testing.B) {
+	m, movies := benchDB(b)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := attachGenresPerMovie(ctx, m, movies); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAttachGenresBatched(b *testing.B) {
+	m, movies := benchDB(b)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := m.attachGenres(ctx, movies); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrInvalidCursor is returned when pagination cursor cannot be decoded or
+// was issued for a different sort field
+var ErrInvalidCursor = errors.New("models: invalid pagination cursor")
+
+// MovieSortFields is the whitelist of fields movies may be sorted by
+var MovieSortFields = []string{
+	"title", "year", "rating", "runtime", "release_date", "created_at",
+}
+
+// MovieFilter type describes pagination, sorting and filtering options of
+// movies listing. Zero value lists all movies ordered by title.
+type MovieFilter struct {
+	Limit       int
+	Offset      int
+	Cursor      string
+	Sort        string
+	Desc        bool
+	YearMin     *int
+	YearMax     *int
+	RatingMin   *int
+	RatingMax   *int
+	MPAARatings []string
+	GenreIDs    []int
+}
+
+// Metadata type describes pagination state of listing response
+type Metadata struct {
+	Total      int    `json:"total"`
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// cursor type is the decoded content of keyset pagination cursor: value of
+// sort field and ID of the last movie on previous page
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// ValidSortField reports whether movies may be sorted by field
+func ValidSortField(field string) bool {
+	for _, f := range MovieSortFields {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sortField returns filter's sort field, defaults to title
+func (f MovieFilter) sortField() string {
+	if ValidSortField(f.Sort) {
+		return f.Sort
+	}
+
+	return "title"
+}
+
+// where builds SQL conditions of filter, appending values of placeholders
+// to args. Keyset condition is included only if cursor is provided.
+func (f MovieFilter) where(args []interface{}, c *cursor) (string, []interface{}) {
+	// Movies in trash are never listed
+	conds := []string{"deleted_at IS NULL"}
+
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if f.YearMin != nil {
+		conds = append(conds, "year >= "+arg(*f.YearMin))
+	}
+	if f.YearMax != nil {
+		conds = append(conds, "year <= "+arg(*f.YearMax))
+	}
+	if f.RatingMin != nil {
+		conds = append(conds, "rating >= "+arg(*f.RatingMin))
+	}
+	if f.RatingMax != nil {
+		conds = append(conds, "rating <= "+arg(*f.RatingMax))
+	}
+	if len(f.MPAARatings) > 0 {
+		conds = append(conds, "mpaa_rating = ANY("+arg(pq.Array(f.MPAARatings))+")")
+	}
+	if len(f.GenreIDs) > 0 {
+		conds = append(conds, "id IN (SELECT movie_id FROM movies_genres WHERE genre_id = ANY("+arg(pq.Array(f.GenreIDs))+"))")
+	}
+	if c != nil {
+		op := ">"
+		if f.Desc {
+			op = "<"
+		}
+		conds = append(conds, fmt.Sprintf("(%s, id) %s (%s, %s)", f.sortField(), op, arg(c.Value), arg(c.ID)))
+	}
+
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// orderBy builds SQL ordering of filter, ID is used as a tie-breaker to
+// keep keyset pagination stable
+func (f MovieFilter) orderBy() string {
+	dir := "ASC"
+	if f.Desc {
+		dir = "DESC"
+	}
+
+	return fmt.Sprintf("%s %s, id %s", f.sortField(), dir, dir)
+}
+
+// decodeCursor returns decoded filter's cursor or nil if no cursor provided
+func (f MovieFilter) decodeCursor() (*cursor, error) {
+	if f.Cursor == "" {
+		return nil, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(f.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	if c.Sort != f.sortField() {
+		return nil, ErrInvalidCursor
+	}
+
+	// Make sure value is of sort field's type before passing it anywhere
+	if _, err := c.movie(); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// nextCursor returns encoded cursor pointing right after the movie
+func (f MovieFilter) nextCursor(movie *Movie) string {
+	c := cursor{
+		Sort:  f.sortField(),
+		Value: sortValue(movie, f.sortField()),
+		ID:    movie.ID,
+	}
+
+	b, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// movie returns a movie holding only cursor's ID and sort field value
+func (c cursor) movie() (*Movie, error) {
+	var err error
+	movie := Movie{ID: c.ID}
+
+	switch c.Sort {
+	case "title":
+		movie.Title = c.Value
+	case "year":
+		movie.Year, err = strconv.Atoi(c.Value)
+	case "rating":
+		movie.Rating, err = strconv.Atoi(c.Value)
+	case "runtime":
+		movie.Runtime, err = strconv.Atoi(c.Value)
+	case "release_date":
+		movie.ReleaseDate, err = time.Parse(time.RFC3339Nano, c.Value)
+	case "created_at":
+		movie.CreatedAt, err = time.Parse(time.RFC3339Nano, c.Value)
+	default:
+		err = ErrInvalidCursor
+	}
+
+	return &movie, err
+}
+
+// sortValue returns movie's field value in cursor's string representation
+func sortValue(movie *Movie, field string) string {
+	switch field {
+	case "year":
+		return strconv.Itoa(movie.Year)
+	case "rating":
+		return strconv.Itoa(movie.Rating)
+	case "runtime":
+		return strconv.Itoa(movie.Runtime)
+	case "release_date":
+		return movie.ReleaseDate.Format(time.RFC3339Nano)
+	case "created_at":
+		return movie.CreatedAt.Format(time.RFC3339Nano)
+	default:
+		return movie.Title
+	}
+}
+
+// compareMovies compares two movies by field, then by ID. Result is
+// negative, zero or positive like in strings.Compare.
+func compareMovies(a, b *Movie, field string) int {
+	var c int
+
+	switch field {
+	case "year":
+		c = a.Year - b.Year
+	case "rating":
+		c = a.Rating - b.Rating
+	case "runtime":
+		c = a.Runtime - b.Runtime
+	case "release_date":
+		c = compareTime(a.ReleaseDate, b.ReleaseDate)
+	case "created_at":
+		c = compareTime(a.CreatedAt, b.CreatedAt)
+	default:
+		c = strings.Compare(a.Title, b.Title)
+	}
+
+	if c != 0 {
+		return c
+	}
+
+	return a.ID - b.ID
+}
+
+func compareTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,439 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// uniqueIDs returns sorted IDs without duplicates, as int64 for pq.Array
+func uniqueIDs(ids []int) []int64 {
+	seen := make(map[int]bool)
+	unique := []int64{}
+
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, int64(id))
+		}
+	}
+
+	sort.Slice(unique, func(i, j int) bool {
+		return unique[i] < unique[j]
+	})
+
+	return unique
+}
+
+// checkGenresFound returns ErrUnknownGenre listing IDs which are not found
+func checkGenresFound(ids []int64, found map[int64]bool) error {
+	var missing []int64
+	for _, id := range ids {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %v", ErrUnknownGenre, missing)
+	}
+
+	return nil
+}
+
+// GenresWithCounts returns all genres ordered by name with number of movies
+// linked with each of them
+func (m *DBModel) GenresWithCounts() ([]*Genre, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, m.Queries.GetAllGenresCounts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var genres []*Genre
+	for rows.Next() {
+		var g Genre
+		var count int
+		if err := rows.Scan(
+			&g.ID,
+			&g.GenreName,
+			&g.CreatedAt,
+			&g.UpdatedAt,
+			&count,
+		); err != nil {
+			return nil, err
+		}
+
+		g.MovieCount = &count
+		genres = append(genres, &g)
+	}
+
+	return genres, rows.Err()
+}
+
+// GetGenre returns one genre or ErrNoRecord
+func (m *DBModel) GetGenre(id int) (*Genre, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var g Genre
+	err := m.DB.QueryRowContext(ctx, m.Queries.GetGenre, id).Scan(
+		&g.ID,
+		&g.GenreName,
+		&g.CreatedAt,
+		&g.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return &g, nil
+}
+
+// InsertGenre creates a new genre and returns its ID. Returns
+// ErrDuplicateGenre if name is already taken.
+func (m *DBModel) InsertGenre(genre Genre) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	var id int
+	err = tx.QueryRowContext(ctx, m.Queries.InsertGenre, genre.GenreName, now, now).Scan(&id)
+	if err != nil {
+		return 0, genreError(err)
+	}
+
+	after, err := m.genreState(ctx, tx, id)
+	if err != nil {
+		return 0, err
+	}
+	if err := m.audit(ctx, tx, AuditCreate, EntityGenre, id, nil, after); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// UpdateGenre renames genre. Returns ErrNoRecord if there is no such genre,
+// ErrDuplicateGenre if name is already taken.
+func (m *DBModel) UpdateGenre(genre Genre) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := m.genreState(ctx, tx, genre.ID)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, m.Queries.UpdateGenre, genre.GenreName, time.Now(), genre.ID)
+	if err != nil {
+		return genreError(err)
+	}
+
+	if err := expectAffected(res); err != nil {
+		return err
+	}
+
+	after, err := m.genreState(ctx, tx, genre.ID)
+	if err != nil {
+		return err
+	}
+	if err := m.audit(ctx, tx, AuditUpdate, EntityGenre, genre.ID, before, after); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MergeGenres links all movies of source genre with target genre and
+// deletes source genre in a single transaction. Returns ErrNoRecord if any
+// of genres doesn't exist.
+func (m *DBModel) MergeGenres(sourceID, targetID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Locking both genres, so none of them is deleted meanwhile
+	rows, err := tx.QueryContext(ctx, m.Queries.LockGenres, pq.Array(uniqueIDs([]int{sourceID, targetID})))
+	if err != nil {
+		return err
+	}
+	var locked int
+	for rows.Next() {
+		locked++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if locked != 2 {
+		return ErrNoRecord
+	}
+
+	before, err := m.genreState(ctx, tx, sourceID)
+	if err != nil {
+		return err
+	}
+
+	movieIDs, err := m.lockGenreMovies(ctx, tx, sourceID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, m.Queries.MergeGenreMovies, sourceID, targetID, time.Now()); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, m.Queries.DeleteGenreMovies, sourceID); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, m.Queries.DeleteGenre, sourceID); err != nil {
+		return err
+	}
+
+	if err := m.genreMoviesChanged(ctx, tx, movieIDs); err != nil {
+		return err
+	}
+
+	after := mergedState(targetID)
+	if err := m.audit(ctx, tx, AuditMerge, EntityGenre, sourceID, before, after); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteGenre deletes genre. If genre is linked with movies, it returns
+// ErrGenreInUse, unless cascade is set - then links are deleted as well.
+// Returns ErrNoRecord if there is no such genre.
+func (m *DBModel) DeleteGenre(id int, cascade bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := m.genreState(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	if err := tx.QueryRowContext(ctx, m.Queries.CountGenreMovies, id).Scan(&count); err != nil {
+		return err
+	}
+
+	var movieIDs []int
+	if count > 0 {
+		if !cascade {
+			return ErrGenreInUse
+		}
+
+		if movieIDs, err = m.lockGenreMovies(ctx, tx, id); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, m.Queries.DeleteGenreMovies, id); err != nil {
+			return err
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, m.Queries.DeleteGenre, id)
+	if err != nil {
+		return err
+	}
+
+	if err := expectAffected(res); err != nil {
+		return err
+	}
+
+	if err := m.genreMoviesChanged(ctx, tx, movieIDs); err != nil {
+		return err
+	}
+
+	if err := m.audit(ctx, tx, AuditDelete, EntityGenre, id, before, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// lockGenreMovies locks movies linked with genre, which genre links are
+// about to be changed by tx, and returns their IDs. Revisions of their
+// current states are saved, if they have none yet.
+func (m *DBModel) lockGenreMovies(ctx context.Context, tx *sql.Tx, genreID int) ([]int, error) {
+	rows, err := tx.QueryContext(ctx, m.Queries.LockGenreMovies, genreID)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Like on update, movies created before revisions were introduced get
+	// their first revision, author of which is unknown
+	if err := m.saveRevisions(ctx, tx, ids, nil); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// genreMoviesChanged increments versions of movies genre links of which
+// were changed by tx, so concurrent updates of their previous versions
+// fail, and saves their revisions.
+func (m *DBModel) genreMoviesChanged(ctx context.Context, tx *sql.Tx, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, m.Queries.BumpMoviesVersion, pq.Array(uniqueIDs(ids)), time.Now()); err != nil {
+		return err
+	}
+
+	return m.saveRevisions(ctx, tx, ids, m.actor)
+}
+
+// saveRevisions saves revisions of current states of movies, movies in
+// trash get none, as on other changes
+func (m *DBModel) saveRevisions(ctx context.Context, tx *sql.Tx, ids []int, actor *Actor) error {
+	for _, id := range ids {
+		err := m.saveRevision(ctx, tx, id, actor)
+		if err != nil && !errors.Is(err, ErrNoRecord) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GenresByMovies returns genres of every movie of movieIDs, ordered by
+// name, by one query. Movies without genres are omitted.
+func (m *DBModel) GenresByMovies(movieIDs []int) (map[int][]*Genre, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, m.Queries.GetGenresOfMovies, pq.Array(uniqueIDs(movieIDs)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := make(map[int][]*Genre)
+	for rows.Next() {
+		var movieID int
+		var g Genre
+		if err := rows.Scan(
+			&movieID,
+			&g.ID,
+			&g.GenreName,
+			&g.CreatedAt,
+			&g.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		genres[movieID] = append(genres[movieID], &g)
+	}
+
+	return genres, rows.Err()
+}
+
+// MoviesByGenres returns up to limit movies linked with every genre of
+// genreIDs, ordered by title, by one query. Genres of movies are not
+// attached, movies in trash are omitted.
+func (m *DBModel) MoviesByGenres(genreIDs []int, limit int) (map[int][]*Movie, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, m.Queries.GetMoviesOfGenres, pq.Array(uniqueIDs(genreIDs)), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := make(map[int][]*Movie)
+	for rows.Next() {
+		var genreID int
+		var movie Movie
+		if err := rows.Scan(
+			&genreID,
+			&movie.ID,
+			&movie.Title,
+			&movie.Description,
+			&movie.Year,
+			&movie.ReleaseDate,
+			&movie.Runtime,
+			&movie.Rating,
+			&movie.MPAARating,
+			&movie.CreatedAt,
+			&movie.UpdatedAt,
+			&movie.Version,
+		); err != nil {
+			return nil, err
+		}
+
+		movies[genreID] = append(movies[genreID], &movie)
+	}
+
+	return movies, rows.Err()
+}
+
+// genreError maps unique violation of genre name to ErrDuplicateGenre
+func genreError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrDuplicateGenre
+	}
+
+	return err
+}
@@ -0,0 +1,1257 @@
+package models
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryModel is a thread-safe in-memory store, which may be used instead of
+// DBModel for local development and testing without PostgreSQL.
+type MemoryModel struct {
+	*memoryData
+	// Changes are audited on behalf of actor, if it's set
+	actor *Actor
+}
+
+// memoryData type is the content of in-memory store, shared by all stores
+// returned by WithActor
+type memoryData struct {
+	mu          sync.RWMutex
+	movies      map[int]Movie
+	trash       map[int]Movie
+	genres      map[int]Genre
+	movieGenres map[int]MovieGenre
+	users       map[int]User
+	userTokens  map[string]UserToken
+	refresh     map[string]*memoryRefreshToken
+	revoked     map[string]time.Time
+	auditLog    []AuditEntry
+	revisions   map[int][]MovieRevision
+	lastID      struct {
+		movie      int
+		genre      int
+		movieGenre int
+		user       int
+		audit      int
+	}
+}
+
+// NewMemoryModel returns an empty in-memory store
+func NewMemoryModel() *MemoryModel {
+	return &MemoryModel{
+		memoryData: &memoryData{
+			movies:      make(map[int]Movie),
+			trash:       make(map[int]Movie),
+			genres:      make(map[int]Genre),
+			movieGenres: make(map[int]MovieGenre),
+			users:       make(map[int]User),
+			userTokens:  make(map[string]UserToken),
+			refresh:     make(map[string]*memoryRefreshToken),
+			revoked:     make(map[string]time.Time),
+			revisions:   make(map[int][]MovieRevision),
+		},
+	}
+}
+
+// memoryRefreshToken type is a stored refresh token with its state
+type memoryRefreshToken struct {
+	RefreshToken
+	used    bool
+	revoked bool
+}
+
+// Get returns a copy of one movie with its genres, or ErrNoRecord
+func (m *MemoryModel) Get(id int) (*Movie, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	movie, ok := m.movies[id]
+	if !ok {
+		return nil, ErrNoRecord
+	}
+
+	movie.MovieGenre = m.genresByMovie(id)
+
+	return &movie, nil
+}
+
+// All returns copies of all movies ordered by title, optionally filtered
+// by genre ID
+func (m *MemoryModel) All(genre ...int) ([]*Movie, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var movies []*Movie
+	for id, movie := range m.movies {
+		if len(genre) > 0 && !m.hasGenre(id, genre[0]) {
+			continue
+		}
+
+		movie := movie
+		movie.MovieGenre = m.genresByMovie(id)
+		movies = append(movies, &movie)
+	}
+
+	sort.Slice(movies, func(i, j int) bool {
+		return movies[i].Title < movies[j].Title
+	})
+
+	return movies, nil
+}
+
+// List returns one page of movies matching filter and pagination metadata,
+// the same way as DBModel does
+func (m *MemoryModel) List(filter MovieFilter) ([]*Movie, Metadata, error) {
+	meta := Metadata{Limit: filter.Limit, Offset: filter.Offset}
+
+	c, err := filter.decodeCursor()
+	if err != nil {
+		return nil, meta, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	movies := []*Movie{}
+	for id, movie := range m.movies {
+		if !m.matches(&movie, filter) {
+			continue
+		}
+
+		movie := movie
+		movie.MovieGenre = m.genresByMovie(id)
+		movies = append(movies, &movie)
+	}
+
+	field := filter.sortField()
+	sort.Slice(movies, func(i, j int) bool {
+		if filter.Desc {
+			return compareMovies(movies[i], movies[j], field) > 0
+		}
+		return compareMovies(movies[i], movies[j], field) < 0
+	})
+
+	meta.Total = len(movies)
+
+	if c != nil {
+		after, _ := c.movie()
+		i := sort.Search(len(movies), func(i int) bool {
+			if filter.Desc {
+				return compareMovies(movies[i], after, field) < 0
+			}
+			return compareMovies(movies[i], after, field) > 0
+		})
+		movies = movies[i:]
+	} else if filter.Offset > 0 {
+		if filter.Offset > len(movies) {
+			filter.Offset = len(movies)
+		}
+		movies = movies[filter.Offset:]
+	}
+
+	if filter.Limit > 0 && len(movies) >= filter.Limit {
+		movies = movies[:filter.Limit]
+		meta.NextCursor = filter.nextCursor(movies[len(movies)-1])
+	}
+
+	return movies, meta, nil
+}
+
+// GenresAll returns copies of all genres ordered by genre name
+func (m *MemoryModel) GenresAll() ([]*Genre, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var genres []*Genre
+	for _, g := range m.genres {
+		g := g
+		genres = append(genres, &g)
+	}
+
+	sort.Slice(genres, func(i, j int) bool {
+		return genres[i].GenreName < genres[j].GenreName
+	})
+
+	return genres, nil
+}
+
+// InsertMovie stores a new movie with the next available ID, linked with
+// genres of genreIDs, and returns its ID
+func (m *MemoryModel) InsertMovie(movie Movie, genreIDs []int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := uniqueIDs(genreIDs)
+	if err := m.checkGenres(ids); err != nil {
+		return 0, err
+	}
+
+	m.lastID.movie++
+	movie.ID = m.lastID.movie
+	movie.Version = 1
+	movie.MovieGenre = nil
+	m.movies[movie.ID] = movie
+
+	m.setMovieGenres(movie.ID, ids)
+	m.saveRevision(movie.ID, m.actor)
+	m.audit(AuditCreate, EntityMovie, movie.ID, nil, m.movieState(movie.ID))
+
+	return movie.ID, nil
+}
+
+// UpdateMovie replaces stored movie fields and, unless genreIDs is nil,
+// its genres, if stored movie version is still movie.Version. Revision of
+// the updated movie is saved.
+func (m *MemoryModel) UpdateMovie(movie Movie, genreIDs []int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.movies[movie.ID]
+	if !ok {
+		return ErrNoRecord
+	}
+	if stored.Version != movie.Version {
+		return ErrEditConflict
+	}
+
+	var ids []int64
+	if genreIDs != nil {
+		ids = uniqueIDs(genreIDs)
+		if err := m.checkGenres(ids); err != nil {
+			return err
+		}
+	}
+
+	before := m.movieState(movie.ID)
+	m.saveRevision(movie.ID, nil)
+
+	movie.Version++
+	movie.MovieGenre = nil
+	m.movies[movie.ID] = movie
+
+	if genreIDs != nil {
+		m.setMovieGenres(movie.ID, ids)
+	}
+
+	m.saveRevision(movie.ID, m.actor)
+	m.audit(AuditUpdate, EntityMovie, movie.ID, before, m.movieState(movie.ID))
+
+	return nil
+}
+
+// DeleteMovie moves movie to trash, keeping its genre links, or returns
+// ErrNoRecord
+func (m *MemoryModel) DeleteMovie(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	movie, ok := m.movies[id]
+	if !ok {
+		return ErrNoRecord
+	}
+
+	before := m.movieState(id)
+
+	now := time.Now()
+	movie.DeletedAt = &now
+	m.trash[id] = movie
+	delete(m.movies, id)
+
+	m.audit(AuditDelete, EntityMovie, id, before, m.movieState(id))
+
+	return nil
+}
+
+// DeletedMovies returns copies of movies in trash with their genres, the
+// most recently deleted first
+func (m *MemoryModel) DeletedMovies() ([]*Movie, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	movies := []*Movie{}
+	for id, movie := range m.trash {
+		movie := movie
+		movie.MovieGenre = m.genresByMovie(id)
+		movies = append(movies, &movie)
+	}
+
+	sort.Slice(movies, func(i, j int) bool {
+		if !movies[i].DeletedAt.Equal(*movies[j].DeletedAt) {
+			return movies[i].DeletedAt.After(*movies[j].DeletedAt)
+		}
+		return movies[i].ID < movies[j].ID
+	})
+
+	return movies, nil
+}
+
+// RestoreMovie takes movie out of trash together with its genre links, or
+// returns ErrNoRecord
+func (m *MemoryModel) RestoreMovie(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	movie, ok := m.trash[id]
+	if !ok {
+		return ErrNoRecord
+	}
+
+	before := m.movieState(id)
+
+	movie.DeletedAt = nil
+	movie.UpdatedAt = time.Now()
+	movie.Version++
+	m.movies[id] = movie
+	delete(m.trash, id)
+	m.saveRevision(id, m.actor)
+
+	m.audit(AuditRestore, EntityMovie, id, before, m.movieState(id))
+
+	return nil
+}
+
+// PurgeDeletedMovies removes movies moved to trash before the given time
+// and all of their genre links, returns number of removed movies
+func (m *MemoryModel) PurgeDeletedMovies(before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ids []int
+	for id, movie := range m.trash {
+		if movie.DeletedAt.Before(before) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	// States are read before movies and their genre links are deleted
+	purged := make(map[int]map[string]interface{}, len(ids))
+	for _, id := range ids {
+		purged[id] = m.movieState(id)
+	}
+	for _, id := range ids {
+		delete(m.trash, id)
+	}
+
+	for mgID, mg := range m.movieGenres {
+		if _, ok := purged[mg.MovieID]; ok {
+			delete(m.movieGenres, mgID)
+		}
+	}
+	for _, id := range ids {
+		delete(m.revisions, id)
+		m.audit(AuditPurge, EntityMovie, id, purged[id], nil)
+	}
+
+	return len(ids), nil
+}
+
+// GenresWithCounts returns copies of all genres ordered by name with
+// number of movies linked with each of them
+func (m *MemoryModel) GenresWithCounts() ([]*Genre, error) {
+	genres, err := m.GenresAll()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, g := range genres {
+		count := m.countGenreMovies(g.ID)
+		g.MovieCount = &count
+	}
+
+	return genres, nil
+}
+
+// GenresByMovies returns copies of genres of every movie of movieIDs,
+// ordered by name. Movies without genres are omitted.
+func (m *MemoryModel) GenresByMovies(movieIDs []int) (map[int][]*Genre, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	wanted := make(map[int]bool)
+	for _, id := range movieIDs {
+		wanted[id] = true
+	}
+
+	genres := make(map[int][]*Genre)
+	for _, mg := range m.movieGenres {
+		if wanted[mg.MovieID] {
+			g := m.genres[mg.GenreID]
+			genres[mg.MovieID] = append(genres[mg.MovieID], &g)
+		}
+	}
+
+	for _, list := range genres {
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].GenreName < list[j].GenreName
+		})
+	}
+
+	return genres, nil
+}
+
+// MoviesByGenres returns copies of up to limit movies linked with every
+// genre of genreIDs, ordered by title. Genres of movies are not attached,
+// movies in trash are omitted.
+func (m *MemoryModel) MoviesByGenres(genreIDs []int, limit int) (map[int][]*Movie, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	wanted := make(map[int]bool)
+	for _, id := range genreIDs {
+		wanted[id] = true
+	}
+
+	movies := make(map[int][]*Movie)
+	for _, mg := range m.movieGenres {
+		movie, ok := m.movies[mg.MovieID]
+		if ok && wanted[mg.GenreID] {
+			movie.MovieGenre = nil
+			movies[mg.GenreID] = append(movies[mg.GenreID], &movie)
+		}
+	}
+
+	for id, list := range movies {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Title != list[j].Title {
+				return list[i].Title < list[j].Title
+			}
+			return list[i].ID < list[j].ID
+		})
+
+		if len(list) > limit {
+			movies[id] = list[:limit]
+		}
+	}
+
+	return movies, nil
+}
+
+// GetGenre returns a copy of one genre, or ErrNoRecord
+func (m *MemoryModel) GetGenre(id int) (*Genre, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	genre, ok := m.genres[id]
+	if !ok {
+		return nil, ErrNoRecord
+	}
+
+	return &genre, nil
+}
+
+// InsertGenre stores a new genre with the next available ID and returns it,
+// or ErrDuplicateGenre
+func (m *MemoryModel) InsertGenre(genre Genre) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.genreNameTaken(genre.GenreName, 0) {
+		return 0, ErrDuplicateGenre
+	}
+
+	now := time.Now()
+	genre.CreatedAt, genre.UpdatedAt = now, now
+	genre.MovieCount = nil
+
+	m.lastID.genre++
+	genre.ID = m.lastID.genre
+	m.genres[genre.ID] = genre
+
+	m.audit(AuditCreate, EntityGenre, genre.ID, nil, m.genreState(genre.ID))
+
+	return genre.ID, nil
+}
+
+// UpdateGenre renames stored genre, returns ErrNoRecord or ErrDuplicateGenre
+func (m *MemoryModel) UpdateGenre(genre Genre) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.genres[genre.ID]
+	if !ok {
+		return ErrNoRecord
+	}
+
+	if m.genreNameTaken(genre.GenreName, genre.ID) {
+		return ErrDuplicateGenre
+	}
+
+	before := m.genreState(genre.ID)
+
+	stored.GenreName = genre.GenreName
+	stored.UpdatedAt = time.Now()
+	m.genres[genre.ID] = stored
+
+	m.audit(AuditUpdate, EntityGenre, genre.ID, before, m.genreState(genre.ID))
+
+	return nil
+}
+
+// MergeGenres links all movies of source genre with target genre and
+// deletes source genre, returns ErrNoRecord if any of genres doesn't exist
+func (m *MemoryModel) MergeGenres(sourceID, targetID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, sourceOK := m.genres[sourceID]
+	_, targetOK := m.genres[targetID]
+	if !sourceOK || !targetOK || sourceID == targetID {
+		return ErrNoRecord
+	}
+
+	before := m.genreState(sourceID)
+	movieIDs := m.lockGenreMovies(sourceID)
+
+	now := time.Now()
+	for mgID, mg := range m.movieGenres {
+		if mg.GenreID != sourceID {
+			continue
+		}
+
+		if m.hasGenre(mg.MovieID, targetID) {
+			delete(m.movieGenres, mgID)
+			continue
+		}
+
+		mg.GenreID = targetID
+		mg.UpdatedAt = now
+		m.movieGenres[mgID] = mg
+	}
+
+	delete(m.genres, sourceID)
+	m.genreMoviesChanged(movieIDs)
+
+	m.audit(AuditMerge, EntityGenre, sourceID, before, mergedState(targetID))
+
+	return nil
+}
+
+// DeleteGenre removes genre, returns ErrNoRecord, or ErrGenreInUse if genre
+// is linked with movies and cascade is not set
+func (m *MemoryModel) DeleteGenre(id int, cascade bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.genres[id]; !ok {
+		return ErrNoRecord
+	}
+
+	// Movies in trash count too, so their genres are kept for restore
+	if m.genreLinked(id) && !cascade {
+		return ErrGenreInUse
+	}
+
+	before := m.genreState(id)
+	movieIDs := m.lockGenreMovies(id)
+
+	for mgID, mg := range m.movieGenres {
+		if mg.GenreID == id {
+			delete(m.movieGenres, mgID)
+		}
+	}
+	delete(m.genres, id)
+	m.genreMoviesChanged(movieIDs)
+
+	m.audit(AuditDelete, EntityGenre, id, before, nil)
+
+	return nil
+}
+
+// lockGenreMovies returns sorted IDs of movies linked with genre, which
+// genre links are about to be changed, and saves revisions of their current
+// states, if they have none yet. Caller must hold the lock.
+func (m *MemoryModel) lockGenreMovies(genreID int) []int {
+	ids := []int{}
+	for _, mg := range m.movieGenres {
+		if mg.GenreID == genreID {
+			ids = append(ids, mg.MovieID)
+		}
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		m.saveRevision(id, nil)
+	}
+
+	return ids
+}
+
+// genreMoviesChanged increments versions of movies genre links of which
+// were changed, including movies in trash, and saves their revisions.
+// Caller must hold the lock.
+func (m *MemoryModel) genreMoviesChanged(ids []int) {
+	now := time.Now()
+	for _, id := range ids {
+		if movie, ok := m.movies[id]; ok {
+			movie.Version++
+			movie.UpdatedAt = now
+			m.movies[id] = movie
+		} else if movie, ok := m.trash[id]; ok {
+			movie.Version++
+			movie.UpdatedAt = now
+			m.trash[id] = movie
+		}
+
+		m.saveRevision(id, m.actor)
+	}
+}
+
+// UpsertGenre returns ID of genre with the same name, storing a new one if
+// there is no such genre
+func (m *MemoryModel) UpsertGenre(genre Genre) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, g := range m.genres {
+		if g.GenreName == genre.GenreName {
+			return id, nil
+		}
+	}
+
+	now := time.Now()
+	genre.CreatedAt, genre.UpdatedAt = now, now
+
+	m.lastID.genre++
+	genre.ID = m.lastID.genre
+	m.genres[genre.ID] = genre
+
+	m.audit(AuditCreate, EntityGenre, genre.ID, nil, m.genreState(genre.ID))
+
+	return genre.ID, nil
+}
+
+// UpsertMovie updates movie with the same title and year and links it with
+// genres of genreIDs, the same way as DBModel does. Returns movie ID
+func (m *MemoryModel) UpsertMovie(movie Movie, genreIDs []int) (int, error) {
+	m.mu.RLock()
+
+	var stored *Movie
+	for id, s := range m.movies {
+		if s.Title == movie.Title && s.Year == movie.Year && (stored == nil || id < stored.ID) {
+			s := s
+			stored = &s
+		}
+	}
+
+	var linked []int64
+	if stored != nil {
+		for _, mg := range m.movieGenres {
+			if mg.MovieID == stored.ID {
+				linked = append(linked, int64(mg.GenreID))
+			}
+		}
+	}
+
+	m.mu.RUnlock()
+
+	if stored == nil {
+		movie.CreatedAt = time.Now()
+		movie.UpdatedAt = movie.CreatedAt
+		return m.InsertMovie(movie, genreIDs)
+	}
+
+	ids, added := seedGenreIDs(linked, genreIDs)
+	if !added && sameMovieFields(stored, &movie) {
+		return stored.ID, nil
+	}
+
+	movie.ID = stored.ID
+	movie.Version = stored.Version
+	movie.CreatedAt = stored.CreatedAt
+	movie.UpdatedAt = time.Now()
+	if err := m.UpdateMovie(movie, ids); err != nil {
+		return 0, err
+	}
+
+	return movie.ID, nil
+}
+
+// InsertUser stores a new user and returns its ID, or ErrDuplicateEmail
+func (m *MemoryModel) InsertUser(user User) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user.Email = normalizeEmail(user.Email)
+	for _, u := range m.users {
+		if u.Email == user.Email {
+			return 0, ErrDuplicateEmail
+		}
+	}
+
+	now := time.Now()
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	user.UpdatedAt = now
+
+	if user.Role == "" {
+		user.Role = RoleViewer
+	}
+
+	m.lastID.user++
+	user.ID = m.lastID.user
+	m.users[user.ID] = user
+
+	return user.ID, nil
+}
+
+// GetUser returns a copy of one user or ErrNoRecord
+func (m *MemoryModel) GetUser(id int) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return nil, ErrNoRecord
+	}
+
+	return &u, nil
+}
+
+// GetUserByEmail returns a copy of one user or ErrNoRecord
+func (m *MemoryModel) GetUserByEmail(email string) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	email = normalizeEmail(email)
+	for _, u := range m.users {
+		if u.Email == email {
+			return &u, nil
+		}
+	}
+
+	return nil, ErrNoRecord
+}
+
+// UpdateUserPassword replaces bcrypt hash of user's password
+func (m *MemoryModel) UpdateUserPassword(id int, passwordHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return ErrNoRecord
+	}
+
+	u.Password = passwordHash
+	u.UpdatedAt = time.Now()
+	m.users[id] = u
+
+	return nil
+}
+
+// DisableUser marks user as disabled
+func (m *MemoryModel) DisableUser(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return ErrNoRecord
+	}
+
+	u.Disabled = true
+	u.UpdatedAt = time.Now()
+	m.users[id] = u
+
+	return nil
+}
+
+// VerifyUser marks user's email as verified
+func (m *MemoryModel) VerifyUser(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return ErrNoRecord
+	}
+
+	u.Verified = true
+	u.UpdatedAt = time.Now()
+	m.users[id] = u
+
+	return nil
+}
+
+// SetUserRole changes role of user
+func (m *MemoryModel) SetUserRole(id int, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return ErrNoRecord
+	}
+
+	u.Role = role
+	u.UpdatedAt = time.Now()
+	m.users[id] = u
+
+	return nil
+}
+
+// InsertUserToken stores a new user token by its hash
+func (m *MemoryModel) InsertUserToken(token UserToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.userTokens[string(token.Hash)] = token
+
+	return nil
+}
+
+// UseUserToken consumes token of scope and returns ID of its user, or
+// ErrNoRecord if token is unknown, expired or was already used
+func (m *MemoryModel) UseUserToken(plaintext, scope string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hash := string(HashToken(plaintext))
+
+	token, ok := m.userTokens[hash]
+	if !ok || token.Scope != scope || !token.Expiry.After(time.Now()) {
+		return 0, ErrNoRecord
+	}
+
+	delete(m.userTokens, hash)
+
+	return token.UserID, nil
+}
+
+// DeleteUserTokens deletes all user tokens of scope
+func (m *MemoryModel) DeleteUserTokens(userID int, scope string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for hash, token := range m.userTokens {
+		if token.UserID == userID && token.Scope == scope {
+			delete(m.userTokens, hash)
+		}
+	}
+
+	return nil
+}
+
+// InsertRefreshToken stores a new refresh token by its hash
+func (m *MemoryModel) InsertRefreshToken(token RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.refresh[string(token.Hash)] = &memoryRefreshToken{RefreshToken: token}
+
+	return nil
+}
+
+// UseRefreshToken marks refresh token as used and returns it, the same way
+// as DBModel does: reuse of token revokes its whole family
+func (m *MemoryModel) UseRefreshToken(plaintext string) (*RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.refresh[string(HashToken(plaintext))]
+	if !ok {
+		return nil, ErrNoRecord
+	}
+
+	if stored.used || stored.revoked {
+		m.revokeRefreshFamily(stored.Family)
+		return nil, ErrTokenReused
+	}
+
+	stored.used = true
+	token := stored.RefreshToken
+
+	return &token, nil
+}
+
+// RevokeRefreshFamily revokes all refresh tokens of family
+func (m *MemoryModel) RevokeRefreshFamily(family string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.revokeRefreshFamily(family)
+
+	return nil
+}
+
+// RevokeUserRefreshFamilies revokes all refresh tokens of user
+func (m *MemoryModel) RevokeUserRefreshFamilies(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, token := range m.refresh {
+		if token.UserID == userID {
+			token.revoked = true
+		}
+	}
+
+	return nil
+}
+
+// RevokeAccessToken adds access token ID into revocation list
+func (m *MemoryModel) RevokeAccessToken(jti string, expiry time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.revoked[jti] = expiry
+
+	return nil
+}
+
+// AccessTokenRevoked reports whether access token ID is in revocation list
+func (m *MemoryModel) AccessTokenRevoked(jti string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.revoked[jti]
+
+	return ok, nil
+}
+
+// PurgeExpiredTokens deletes expired refresh, user and revoked access tokens
+func (m *MemoryModel) PurgeExpiredTokens() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for jti, expiry := range m.revoked {
+		if expiry.Before(now) {
+			delete(m.revoked, jti)
+		}
+	}
+	for hash, token := range m.refresh {
+		if token.Expiry.Before(now) {
+			delete(m.refresh, hash)
+		}
+	}
+	for hash, token := range m.userTokens {
+		if token.Expiry.Before(now) {
+			delete(m.userTokens, hash)
+		}
+	}
+
+	return nil
+}
+
+// revokeRefreshFamily revokes all refresh tokens of family. Caller must
+// hold the lock.
+func (m *MemoryModel) revokeRefreshFamily(family string) {
+	for _, token := range m.refresh {
+		if token.Family == family {
+			token.revoked = true
+		}
+	}
+}
+
+// genresByMovie builds the same genres map as DBModel does: link ID to
+// genre name. Caller must hold the lock.
+func (m *MemoryModel) genresByMovie(movieID int) map[int]string {
+	genres := make(map[int]string)
+	for _, mg := range m.movieGenres {
+		if mg.MovieID == movieID {
+			genres[mg.ID] = m.genres[mg.GenreID].GenreName
+		}
+	}
+
+	return genres
+}
+
+// matches reports whether movie satisfies all filter conditions. Caller
+// must hold the lock.
+func (m *MemoryModel) matches(movie *Movie, filter MovieFilter) bool {
+	if filter.YearMin != nil && movie.Year < *filter.YearMin {
+		return false
+	}
+	if filter.YearMax != nil && movie.Year > *filter.YearMax {
+		return false
+	}
+	if filter.RatingMin != nil && movie.Rating < *filter.RatingMin {
+		return false
+	}
+	if filter.RatingMax != nil && movie.Rating > *filter.RatingMax {
+		return false
+	}
+
+	if len(filter.MPAARatings) > 0 {
+		found := false
+		for _, r := range filter.MPAARatings {
+			if r == movie.MPAARating {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(filter.GenreIDs) > 0 {
+		found := false
+		for _, genreID := range filter.GenreIDs {
+			if m.hasGenre(movie.ID, genreID) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkGenres returns ErrUnknownGenre if any of genres doesn't exist.
+// Caller must hold the lock.
+func (m *MemoryModel) checkGenres(ids []int64) error {
+	found := make(map[int64]bool)
+	for _, id := range ids {
+		_, found[id] = m.genres[int(id)]
+	}
+
+	return checkGenresFound(ids, found)
+}
+
+// setMovieGenres links movie with genres of ids only, keeping existing
+// links. Caller must hold the lock.
+func (m *MemoryModel) setMovieGenres(movieID int, ids []int64) {
+	keep := make(map[int]bool)
+	for _, id := range ids {
+		keep[int(id)] = true
+	}
+
+	for mgID, mg := range m.movieGenres {
+		if mg.MovieID != movieID {
+			continue
+		}
+		if keep[mg.GenreID] {
+			delete(keep, mg.GenreID)
+		} else {
+			delete(m.movieGenres, mgID)
+		}
+	}
+
+	now := time.Now()
+	for _, id := range ids {
+		if !keep[int(id)] {
+			continue
+		}
+
+		m.lastID.movieGenre++
+		m.movieGenres[m.lastID.movieGenre] = MovieGenre{
+			ID:        m.lastID.movieGenre,
+			MovieID:   movieID,
+			GenreID:   int(id),
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+	}
+}
+
+// countGenreMovies returns number of movies linked with genre, movies in
+// trash are not counted. Caller must hold the lock.
+func (m *MemoryModel) countGenreMovies(genreID int) int {
+	var count int
+	for _, mg := range m.movieGenres {
+		if _, ok := m.movies[mg.MovieID]; ok && mg.GenreID == genreID {
+			count++
+		}
+	}
+
+	return count
+}
+
+// genreLinked reports whether genre is linked with any movie, including
+// movies in trash. Caller must hold the lock.
+func (m *MemoryModel) genreLinked(genreID int) bool {
+	for _, mg := range m.movieGenres {
+		if mg.GenreID == genreID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// genreNameTaken reports whether genre other than exceptID has name. Caller
+// must hold the lock.
+func (m *MemoryModel) genreNameTaken(name string, exceptID int) bool {
+	for id, g := range m.genres {
+		if id != exceptID && g.GenreName == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasGenre reports whether movie is linked with genre. Caller must hold
+// the lock.
+func (m *MemoryModel) hasGenre(movieID, genreID int) bool {
+	for _, mg := range m.movieGenres {
+		if mg.MovieID == movieID && mg.GenreID == genreID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WithActor returns store writing audit entries of all catalogue changes on
+// behalf of actor. It shares all data with m.
+func (m *MemoryModel) WithActor(actor Actor) Store {
+	return &MemoryModel{memoryData: m.memoryData, actor: &actor}
+}
+
+// AuditLog returns copies of audit entries matching filter, the most recent
+// first, and pagination metadata
+func (m *MemoryModel) AuditLog(filter AuditFilter) ([]*AuditEntry, Metadata, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	meta := Metadata{Limit: filter.Limit, Offset: filter.Offset}
+
+	// Entries are appended, so the most recent ones are at the end
+	entries := []*AuditEntry{}
+	for i := len(m.auditLog) - 1; i >= 0; i-- {
+		entry := m.auditLog[i]
+		if filter.matches(&entry) {
+			entries = append(entries, &entry)
+		}
+	}
+
+	meta.Total = len(entries)
+
+	if filter.Offset > len(entries) {
+		filter.Offset = len(entries)
+	}
+	entries = entries[filter.Offset:]
+
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[:filter.Limit]
+	}
+
+	return entries, meta, nil
+}
+
+// audit appends audit entry of change, if store has an actor. Caller must
+// hold the lock.
+func (m *MemoryModel) audit(action, entity string, id int, before, after map[string]interface{}) {
+	entry := newAuditEntry(m.actor, action, entity, id, before, after)
+	if entry == nil {
+		return
+	}
+
+	m.lastID.audit++
+	entry.ID = m.lastID.audit
+	m.auditLog = append(m.auditLog, *entry)
+}
+
+// movieState returns audited state of stored movie or movie in trash, nil
+// if store has no actor. Caller must hold the lock.
+func (m *MemoryModel) movieState(id int) map[string]interface{} {
+	if m.actor == nil {
+		return nil
+	}
+
+	movie, ok := m.movies[id]
+	if !ok {
+		movie, ok = m.trash[id]
+	}
+	if !ok {
+		return nil
+	}
+
+	genreIDs := []int{}
+	for _, mg := range m.movieGenres {
+		if mg.MovieID == id {
+			genreIDs = append(genreIDs, mg.GenreID)
+		}
+	}
+
+	return snapshotMovie(movie, uniqueIDs(genreIDs))
+}
+
+// genreState returns audited state of stored genre, nil if store has no
+// actor. Caller must hold the lock.
+func (m *MemoryModel) genreState(id int) map[string]interface{} {
+	genre, ok := m.genres[id]
+	if m.actor == nil || !ok {
+		return nil
+	}
+
+	return snapshotGenre(genre)
+}
+
+// MovieRevisions returns copies of all revisions of movie, the latest first
+func (m *MemoryModel) MovieRevisions(movieID int) ([]*MovieRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	revisions := []*MovieRevision{}
+	for i := len(m.revisions[movieID]) - 1; i >= 0; i-- {
+		rev := m.revisions[movieID][i]
+		revisions = append(revisions, &rev)
+	}
+
+	return revisions, nil
+}
+
+// MovieRevision returns a copy of one revision of movie or ErrNoRecord
+func (m *MemoryModel) MovieRevision(movieID, revision int) (*MovieRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, rev := range m.revisions[movieID] {
+		if rev.Revision == revision {
+			return &rev, nil
+		}
+	}
+
+	return nil, ErrNoRecord
+}
+
+// saveRevision saves revision of stored movie's current state, unless
+// there is one already. Author is the actor, if any. Caller must hold the
+// lock.
+func (m *MemoryModel) saveRevision(id int, actor *Actor) {
+	movie, ok := m.movies[id]
+	if !ok {
+		return
+	}
+
+	revisions := m.revisions[id]
+	if len(revisions) > 0 && revisions[len(revisions)-1].Revision >= movie.Version {
+		return
+	}
+
+	movie.MovieGenre = m.genresByMovie(id)
+
+	genreIDs := []int{}
+	for _, mg := range m.movieGenres {
+		if mg.MovieID == id {
+			genreIDs = append(genreIDs, mg.GenreID)
+		}
+	}
+	sort.Ints(genreIDs)
+
+	rev := MovieRevision{
+		MovieID:   id,
+		Revision:  movie.Version,
+		Movie:     movie,
+		GenreIDs:  genreIDs,
+		CreatedAt: time.Now(),
+	}
+	if actor != nil {
+		actorID := actor.UserID
+		rev.ActorID = &actorID
+	}
+
+	m.revisions[id] = append(revisions, rev)
+}
@@ -2,30 +2,151 @@ package models
 
 import (
 	"database/sql"
+	"errors"
 	"time"
 )
 
+// ErrNoRecord is returned by stores when requested record does not exist
+var ErrNoRecord = errors.New("models: no matching record found")
+
+// ErrTokenReused is returned when already used or revoked refresh token is
+// presented again
+var ErrTokenReused = errors.New("models: refresh token reused")
+
+// ErrUnknownGenre is returned when movie is linked with genre which does not
+// exist
+var ErrUnknownGenre = errors.New("models: unknown genre")
+
+// ErrDuplicateGenre is returned when genre with the same name already exists
+var ErrDuplicateGenre = errors.New("models: duplicate genre name")
+
+// ErrGenreInUse is returned when genre linked with movies is deleted without
+// cascade
+var ErrGenreInUse = errors.New("models: genre is linked with movies")
+
+// ErrEditConflict is returned when movie is updated with version, which is
+// not its current version anymore
+var ErrEditConflict = errors.New("models: edit conflict")
+
+// ErrDuplicateEmail is returned when user with the same email already exists
+var ErrDuplicateEmail = errors.New("models: duplicate email")
+
+// MovieStore describes all operations available over movies collection
+type MovieStore interface {
+	Get(id int) (*Movie, error)
+	All(genre ...int) ([]*Movie, error)
+	List(filter MovieFilter) ([]*Movie, Metadata, error)
+	Search(query string, limit int) ([]*SearchResult, error)
+	InsertMovie(movie Movie, genreIDs []int) (int, error)
+	UpdateMovie(movie Movie, genreIDs []int) error
+	DeleteMovie(id int) error
+	DeletedMovies() ([]*Movie, error)
+	RestoreMovie(id int) error
+	PurgeDeletedMovies(before time.Time) (int, error)
+}
+
+// GenreStore describes all operations available over genres collection
+type GenreStore interface {
+	GenresAll() ([]*Genre, error)
+	GenresWithCounts() ([]*Genre, error)
+	GetGenre(id int) (*Genre, error)
+	InsertGenre(genre Genre) (int, error)
+	UpdateGenre(genre Genre) error
+	MergeGenres(sourceID, targetID int) error
+	DeleteGenre(id int, cascade bool) error
+	GenresByMovies(movieIDs []int) (map[int][]*Genre, error)
+	MoviesByGenres(genreIDs []int, limit int) (map[int][]*Movie, error)
+}
+
+// SeedStore describes idempotent operations used to load fixtures: records
+// are matched by natural key and updated if they already exist
+type SeedStore interface {
+	UpsertGenre(genre Genre) (int, error)
+	UpsertMovie(movie Movie, genreIDs []int) (int, error)
+}
+
+// UserStore describes all operations available over user accounts
+type UserStore interface {
+	InsertUser(user User) (int, error)
+	GetUser(id int) (*User, error)
+	GetUserByEmail(email string) (*User, error)
+	UpdateUserPassword(id int, passwordHash string) error
+	DisableUser(id int) error
+	VerifyUser(id int) error
+	SetUserRole(id int, role string) error
+	InsertUserToken(token UserToken) error
+	UseUserToken(plaintext, scope string) (int, error)
+	DeleteUserTokens(userID int, scope string) error
+}
+
+// TokenStore describes operations over refresh tokens and revoked access
+// tokens
+type TokenStore interface {
+	InsertRefreshToken(token RefreshToken) error
+	UseRefreshToken(plaintext string) (*RefreshToken, error)
+	RevokeRefreshFamily(family string) error
+	RevokeUserRefreshFamilies(userID int) error
+	RevokeAccessToken(jti string, expiry time.Time) error
+	AccessTokenRevoked(jti string) (bool, error)
+	PurgeExpiredTokens() error
+}
+
+// RevisionStore describes edit history of movies: revision is saved on
+// every movie insert and update
+type RevisionStore interface {
+	MovieRevisions(movieID int) ([]*MovieRevision, error)
+	MovieRevision(movieID, revision int) (*MovieRevision, error)
+}
+
+// AuditStore describes audit log of catalogue changes. Movie and genre
+// changes are audited only by store returned by WithActor.
+type AuditStore interface {
+	WithActor(actor Actor) Store
+	AuditLog(filter AuditFilter) ([]*AuditEntry, Metadata, error)
+}
+
+// Store combines all collection stores the application depends on
+type Store interface {
+	MovieStore
+	GenreStore
+	SeedStore
+	UserStore
+	TokenStore
+	AuditStore
+	RevisionStore
+}
+
 // Generic type for model containing DB pool
 type DBModel struct {
 	DB      *sql.DB
 	Queries Queries
+	// Changes are audited on behalf of actor, if it's set
+	actor *Actor
 }
 
 // Models is the wrapper for database
 type Models struct {
-	DB DBModel
+	DB Store
 }
 
 // NewModels returns models with DB pool
 func NewModels(db *sql.DB) Models {
 	return Models{
-		DB: DBModel{
+		DB: &DBModel{
 			DB:      db,
 			Queries: prepareQueries(),
 		},
 	}
 }
 
+// NewMemoryModels returns models backed by in-memory store, no database
+// connection is required
+func NewMemoryModels() Models {
+	return Models{
+		DB: NewMemoryModel(),
+	}
+}
+
 // Movie type describes Movie's meta information fields
 type Movie struct {
 	ID          int            `json:"id"`
@@ -38,15 +159,42 @@ type Movie struct {
 	MPAARating  string         `json:"mpaa_rating"`
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
+	Version     int            `json:"version"`
+	DeletedAt   *time.Time     `json:"deleted_at,omitempty"`
 	MovieGenre  map[int]string `json:"genres"`
 }
 
-// Genre type describes Genre's meta information fields
+// MPAARatings lists allowed MPAA ratings of movies
+var MPAARatings = []string{"G", "PG", "PG-13", "R", "NC-17"}
+
+// ValidMPAARating reports whether rating is one of MPAARatings
+func ValidMPAARating(rating string) bool {
+	for _, r := range MPAARatings {
+		if r == rating {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SearchResult type describes a movie found by full-text search with its
+// rank and highlighted fragments, matched terms are wrapped in <b> tags
+type SearchResult struct {
+	Movie
+	Rank           float64 `json:"rank"`
+	TitleHighlight string  `json:"title_highlight"`
+	Snippet        string  `json:"snippet"`
+}
+
+// Genre type describes Genre's meta information fields. MovieCount is set
+// only when genres are requested with counts.
 type Genre struct {
-	ID        int       `json:"id"`
-	GenreName string    `json:"genre_name"`
-	CreatedAt time.Time `json:"-"`
-	UpdatedAt time.Time `json:"-"`
+	ID         int       `json:"id"`
+	GenreName  string    `json:"genre_name"`
+	MovieCount *int      `json:"movie_count,omitempty"`
+	CreatedAt  time.Time `json:"-"`
+	UpdatedAt  time.Time `json:"-"`
 }
 
 // MovieGenre type describes a link between Movie and its Genre
@@ -59,9 +207,15 @@ type MovieGenre struct {
 	UpdatedAt time.Time `json:"-"`
 }
 
-// User type describes User's information
+// User type describes User's information. Password is a bcrypt hash of
+// user's password, it's never serialized.
 type User struct {
-	ID       int
-	Email    string
-	Password string
+	ID        int       `json:"id"`
+	Email     string    `json:"email"`
+	Password  string    `json:"-"`
+	Disabled  bool      `json:"disabled"`
+	Verified  bool      `json:"verified"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
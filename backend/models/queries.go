@@ -3,12 +3,73 @@ package models
 type Queries struct {
 	GetMovie           string
 	GetGenresByMovie   string
+	GetGenresByMovies  string
 	GetAllMovies       string
 	GetAllMoviesClause string
+	ListMovies         string
+	CountMovies        string
+	SearchMovies       string
 	GetAllGenres       string
 	InsertMovie        string
 	UpdateMovie        string
 	DeleteMovie        string
+	InsertUser         string
+	GetUser            string
+	GetUserByEmail     string
+	UpdateUserPassword string
+	DisableUser        string
+	VerifyUser         string
+	SetUserRole        string
+	InsertUserToken    string
+	UseUserToken       string
+	DeleteUserTokens   string
+
+	InsertRefreshToken  string
+	UseRefreshToken     string
+	GetRefreshFamily    string
+	RevokeRefreshFamily string
+	RevokeUserRefresh   string
+	RevokeAccessToken   string
+	AccessTokenRevoked  string
+	PurgeExpiredTokens  []string
+
+	GetMovieByKey           string
+	GetGenreByName          string
+	LinkMovieGenre          string
+	GetGenreIDs             string
+	DeleteMovieGenresExcept string
+
+	GetAllGenresCounts string
+	GetGenre           string
+	InsertGenre        string
+	UpdateGenre        string
+	LockGenres         string
+	CountGenreMovies   string
+	MergeGenreMovies   string
+	DeleteGenreMovies  string
+	DeleteGenre        string
+	LockGenreMovies    string
+	BumpMoviesVersion  string
+
+	GetMovieVersion string
+
+	GetDeletedMovies   string
+	RestoreMovie       string
+	GetPurgedMovies    string
+	PurgeDeletedMovies string
+
+	GetMovieSnapshot  string
+	GetGenreSnapshot  string
+	InsertAuditEntry  string
+	GetAuditEntries   string
+	CountAuditEntries string
+
+	InsertMovieRevision string
+	GetMovieRevisions   string
+	GetMovieRevision    string
+
+	GetGenresOfMovies string
+	GetMoviesOfGenres string
 }
 
 func prepareQueries() Queries {
@@ -17,11 +78,11 @@ func prepareQueries() Queries {
 	queries.GetMovie = `
 		SELECT
 			id, title, description, year, release_date, runtime, rating,
-			mpaa_rating, created_at, updated_at
+			mpaa_rating, created_at, updated_at, version
 		FROM
 			movies
 		WHERE
-			id = $1
+			id = $1 AND deleted_at IS NULL
 	`
 
 	queries.GetGenresByMovie = `
@@ -34,22 +95,82 @@ func prepareQueries() Queries {
 			mg.movie_id = $1
 	`
 
+	queries.GetGenresByMovies = `
+		SELECT
+			mg.id, mg.movie_id, mg.genre_id, g.genre_name
+		FROM
+			movies_genres mg
+			LEFT JOIN genres g ON (g.id = mg.genre_id)
+		WHERE
+			mg.movie_id = ANY($1)
+	`
+
 	queries.GetAllMovies = `
 		SELECT
 			id, title, description, year, release_date, runtime, rating,
-			mpaa_rating, created_at, updated_at
+			mpaa_rating, created_at, updated_at, version
 		FROM
-			movies 
+			movies
+		WHERE
+			deleted_at IS NULL
 		%s
 		ORDER BY
 			title
 	`
 
 	queries.GetAllMoviesClause = `
-		WHERE id
+		AND id
 		IN (SELECT movie_id FROM movies_genres WHERE genre_id = %d)
 	`
 
+	queries.ListMovies = `
+		SELECT
+			id, title, description, year, release_date, runtime, rating,
+			mpaa_rating, created_at, updated_at, version
+		FROM
+			movies
+		%s
+		ORDER BY
+			%s
+		%s
+	`
+
+	queries.CountMovies = `
+		SELECT
+			count(*)
+		FROM
+			movies
+		%s
+	`
+
+	// Document is weighted: title matches rank higher than description ones.
+	// It's computed on the fly, so an expression GIN index over the same
+	// document is needed for large catalogues.
+	queries.SearchMovies = `
+		SELECT
+			m.id, m.title, m.description, m.year, m.release_date, m.runtime,
+			m.rating, m.mpaa_rating, m.created_at, m.updated_at, m.version,
+			ts_rank(d.document, q.query) AS rank,
+			ts_headline('english', m.title, q.query,
+				'StartSel=<b>, StopSel=</b>, HighlightAll=true'),
+			ts_headline('english', m.description, q.query,
+				'StartSel=<b>, StopSel=</b>, MaxFragments=2, MaxWords=20, MinWords=5')
+		FROM
+			movies m
+			CROSS JOIN to_tsquery('english', $1) q(query)
+			CROSS JOIN LATERAL (
+				SELECT
+					setweight(to_tsvector('english', coalesce(m.title, '')), 'A') ||
+					setweight(to_tsvector('english', coalesce(m.description, '')), 'B')
+					AS document
+			) d
+		WHERE
+			d.document @@ q.query AND m.deleted_at IS NULL
+		ORDER BY
+			rank DESC, m.title
+		LIMIT $2
+	`
+
 	queries.GetAllGenres = `
 		SELECT
 			id, genre_name, created_at, updated_at
@@ -59,12 +180,114 @@ func prepareQueries() Queries {
 			genre_name
 	`
 
+	queries.GetAllGenresCounts = `
+		SELECT
+			g.id, g.genre_name, g.created_at, g.updated_at, count(m.id)
+		FROM
+			genres g
+			LEFT JOIN movies_genres mg ON (mg.genre_id = g.id)
+			LEFT JOIN movies m ON (m.id = mg.movie_id AND m.deleted_at IS NULL)
+		GROUP BY
+			g.id
+		ORDER BY
+			g.genre_name
+	`
+
+	queries.GetGenre = `
+		SELECT
+			id, genre_name, created_at, updated_at
+		FROM
+			genres
+		WHERE
+			id = $1
+	`
+
+	queries.UpdateGenre = `
+		UPDATE
+			genres
+		SET
+			genre_name = $1, updated_at = $2
+		WHERE
+			id = $3
+	`
+
+	// Links of movies in trash count too, so they aren't lost on restore
+	queries.CountGenreMovies = `
+		SELECT
+			count(*)
+		FROM
+			movies_genres
+		WHERE
+			genre_id = $1
+	`
+
+	// Movies linked with both genres keep only the link to target genre
+	queries.MergeGenreMovies = `
+		INSERT INTO
+			movies_genres
+		(movie_id, genre_id, created_at, updated_at)
+		SELECT
+			movie_id, $2::integer, $3::timestamp, $3::timestamp
+		FROM
+			movies_genres
+		WHERE
+			genre_id = $1
+			AND movie_id NOT IN (SELECT movie_id FROM movies_genres WHERE genre_id = $2)
+	`
+
+	queries.DeleteGenreMovies = `
+		DELETE FROM
+			movies_genres
+		WHERE
+			genre_id = $1
+	`
+
+	// Movies in trash are locked too, their genres are changed as well
+	queries.LockGenreMovies = `
+		SELECT
+			id
+		FROM
+			movies
+		WHERE
+			id IN (SELECT movie_id FROM movies_genres WHERE genre_id = $1)
+		ORDER BY
+			id
+		FOR UPDATE
+	`
+
+	queries.BumpMoviesVersion = `
+		UPDATE
+			movies
+		SET
+			version = version + 1, updated_at = $2
+		WHERE
+			id = ANY($1)
+	`
+
+	queries.DeleteGenre = `
+		DELETE FROM
+			genres
+		WHERE
+			id = $1
+	`
+
+	queries.LockGenres = `
+		SELECT
+			id
+		FROM
+			genres
+		WHERE
+			id = ANY($1)
+		FOR UPDATE
+	`
+
 	queries.InsertMovie = `
 		INSERT INTO
 			movies
 		(title, description, year, release_date, runtime, rating, mpaa_rating, created_at, updated_at)
 		values
 		($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
 	`
 
 	queries.UpdateMovie = `
@@ -73,17 +296,402 @@ func prepareQueries() Queries {
 		SET
 			title = $1, description = $2, year = $3,
 			release_date = $4, runtime = $5, rating = $6,
-			mpaa_rating = $7, updated_at = $8
+			mpaa_rating = $7, updated_at = $8, version = version + 1
 		WHERE
-			id = $9
+			id = $9 AND version = $10 AND deleted_at IS NULL
 	`
 
+	queries.GetMovieVersion = `
+		SELECT
+			version
+		FROM
+			movies
+		WHERE
+			id = $1 AND deleted_at IS NULL
+	`
+
+	// Movie is moved to trash, genre links are kept for restore
 	queries.DeleteMovie = `
+		UPDATE
+			movies
+		SET
+			deleted_at = $2
+		WHERE
+			id = $1 AND deleted_at IS NULL
+	`
+
+	queries.GetDeletedMovies = `
+		SELECT
+			id, title, description, year, release_date, runtime, rating,
+			mpaa_rating, created_at, updated_at, version, deleted_at
+		FROM
+			movies
+		WHERE
+			deleted_at IS NOT NULL
+		ORDER BY
+			deleted_at DESC, id
+	`
+
+	queries.RestoreMovie = `
+		UPDATE
+			movies
+		SET
+			deleted_at = NULL, updated_at = $2, version = version + 1
+		WHERE
+			id = $1 AND deleted_at IS NOT NULL
+	`
+
+	// Genre links are deleted by cascade
+	queries.GetPurgedMovies = `
+		SELECT
+			id
+		FROM
+			movies
+		WHERE
+			deleted_at < $1
+		ORDER BY
+			id
+		FOR UPDATE
+	`
+
+	queries.PurgeDeletedMovies = `
 		DELETE FROM
 			movies
+		WHERE
+			id = ANY($1)
+	`
+
+	queries.GetMovieByKey = `
+		SELECT
+			id, title, description, year, release_date, runtime, rating,
+			mpaa_rating, version,
+			ARRAY(SELECT genre_id FROM movies_genres WHERE movie_id = m.id ORDER BY genre_id)
+		FROM
+			movies m
+		WHERE
+			title = $1 AND year = $2 AND deleted_at IS NULL
+		ORDER BY
+			id
+		LIMIT 1
+	`
+
+	queries.GetGenreByName = `
+		SELECT
+			id
+		FROM
+			genres
+		WHERE
+			genre_name = $1
+	`
+
+	queries.InsertGenre = `
+		INSERT INTO
+			genres
+		(genre_name, created_at, updated_at)
+		values
+		($1, $2, $3)
+		RETURNING id
+	`
+
+	// Types of select list params can't be inferred, so they are cast
+	queries.LinkMovieGenre = `
+		INSERT INTO
+			movies_genres
+		(movie_id, genre_id, created_at, updated_at)
+		SELECT
+			$1::integer, $2::integer, $3::timestamp, $3::timestamp
+		WHERE NOT EXISTS (
+			SELECT 1 FROM movies_genres WHERE movie_id = $1 AND genre_id = $2
+		)
+	`
+
+	queries.GetGenreIDs = `
+		SELECT
+			id
+		FROM
+			genres
+		WHERE
+			id = ANY($1)
+	`
+
+	queries.DeleteMovieGenresExcept = `
+		DELETE FROM
+			movies_genres
+		WHERE
+			movie_id = $1 AND NOT (genre_id = ANY($2))
+	`
+
+	// Movies in trash are audited as well
+	queries.GetMovieSnapshot = `
+		SELECT
+			title, description, year, release_date, runtime, rating,
+			mpaa_rating, version, deleted_at,
+			ARRAY(SELECT genre_id FROM movies_genres WHERE movie_id = m.id ORDER BY genre_id)
+		FROM
+			movies m
 		WHERE
 			id = $1
+		FOR UPDATE
+	`
+
+	queries.GetGenreSnapshot = `
+		SELECT
+			genre_name
+		FROM
+			genres
+		WHERE
+			id = $1
+		FOR UPDATE
+	`
+
+	queries.InsertAuditEntry = `
+		INSERT INTO
+			audit_log
+		(actor_id, action, entity, entity_id, changes, request_id, created_at)
+		values
+		($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	queries.GetAuditEntries = `
+		SELECT
+			id, actor_id, action, entity, entity_id, changes, request_id,
+			created_at
+		FROM
+			audit_log
+		%s
+		ORDER BY
+			created_at DESC, id DESC
+		%s
 	`
 
+	queries.CountAuditEntries = `
+		SELECT
+			count(*)
+		FROM
+			audit_log
+		%s
+	`
+
+	// Revision of the same version is saved once: state before update is
+	// saved only if movie has no revision of it yet
+	queries.InsertMovieRevision = `
+		INSERT INTO
+			movie_revisions
+		(movie_id, revision, movie, genre_ids, actor_id, created_at)
+		values
+		($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (movie_id, revision) DO NOTHING
+	`
+
+	queries.GetMovieRevisions = `
+		SELECT
+			movie_id, revision, movie, genre_ids, actor_id, created_at
+		FROM
+			movie_revisions
+		WHERE
+			movie_id = $1
+		ORDER BY
+			revision DESC
+	`
+
+	queries.GetMovieRevision = `
+		SELECT
+			movie_id, revision, movie, genre_ids, actor_id, created_at
+		FROM
+			movie_revisions
+		WHERE
+			movie_id = $1 AND revision = $2
+	`
+
+	queries.GetGenresOfMovies = `
+		SELECT
+			mg.movie_id, g.id, g.genre_name, g.created_at, g.updated_at
+		FROM
+			movies_genres mg
+			JOIN genres g ON (g.id = mg.genre_id)
+		WHERE
+			mg.movie_id = ANY($1)
+		ORDER BY
+			g.genre_name
+	`
+
+	// Movies are numbered within every genre, so each genre gets up to $2
+	queries.GetMoviesOfGenres = `
+		SELECT
+			genre_id, id, title, description, year, release_date, runtime,
+			rating, mpaa_rating, created_at, updated_at, version
+		FROM (
+			SELECT
+				mg.genre_id, m.id, m.title, m.description, m.year,
+				m.release_date, m.runtime, m.rating, m.mpaa_rating,
+				m.created_at, m.updated_at, m.version,
+				row_number() OVER (PARTITION BY mg.genre_id ORDER BY m.title, m.id) AS n
+			FROM
+				movies_genres mg
+				JOIN movies m ON (m.id = mg.movie_id)
+			WHERE
+				mg.genre_id = ANY($1) AND m.deleted_at IS NULL
+		) AS ranked
+		WHERE
+			n <= $2
+		ORDER BY
+			title, id
+	`
+
+	queries.InsertUser = `
+		INSERT INTO
+			users
+		(email, password_hash, disabled, verified, role, created_at, updated_at)
+		values
+		($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`
+
+	queries.GetUser = `
+		SELECT
+			id, email, password_hash, disabled, verified, role, created_at,
+			updated_at
+		FROM
+			users
+		WHERE
+			id = $1
+	`
+
+	queries.GetUserByEmail = `
+		SELECT
+			id, email, password_hash, disabled, verified, role, created_at,
+			updated_at
+		FROM
+			users
+		WHERE
+			email = $1
+	`
+
+	queries.UpdateUserPassword = `
+		UPDATE
+			users
+		SET
+			password_hash = $1, updated_at = $2
+		WHERE
+			id = $3
+	`
+
+	queries.DisableUser = `
+		UPDATE
+			users
+		SET
+			disabled = true, updated_at = $1
+		WHERE
+			id = $2
+	`
+
+	queries.VerifyUser = `
+		UPDATE
+			users
+		SET
+			verified = true, updated_at = $1
+		WHERE
+			id = $2
+	`
+
+	queries.SetUserRole = `
+		UPDATE
+			users
+		SET
+			role = $1, updated_at = $2
+		WHERE
+			id = $3
+	`
+
+	queries.InsertUserToken = `
+		INSERT INTO
+			user_tokens
+		(hash, user_id, scope, expires_at, created_at)
+		values
+		($1, $2, $3, $4, $5)
+	`
+
+	// Token is deleted by the same statement it's checked with, so it can
+	// never be used twice
+	queries.UseUserToken = `
+		DELETE FROM
+			user_tokens
+		WHERE
+			hash = $1 AND scope = $2 AND expires_at > $3
+		RETURNING user_id
+	`
+
+	queries.DeleteUserTokens = `
+		DELETE FROM
+			user_tokens
+		WHERE
+			user_id = $1 AND scope = $2
+	`
+
+	queries.InsertRefreshToken = `
+		INSERT INTO
+			refresh_tokens
+		(hash, user_id, family, expires_at, created_at)
+		values
+		($1, $2, $3, $4, $5)
+	`
+
+	queries.UseRefreshToken = `
+		UPDATE
+			refresh_tokens
+		SET
+			used_at = $2
+		WHERE
+			hash = $1 AND used_at IS NULL AND NOT revoked
+		RETURNING user_id, family, expires_at
+	`
+
+	queries.GetRefreshFamily = `
+		SELECT
+			family
+		FROM
+			refresh_tokens
+		WHERE
+			hash = $1
+	`
+
+	queries.RevokeRefreshFamily = `
+		UPDATE
+			refresh_tokens
+		SET
+			revoked = true
+		WHERE
+			family = $1
+	`
+
+	queries.RevokeUserRefresh = `
+		UPDATE
+			refresh_tokens
+		SET
+			revoked = true
+		WHERE
+			user_id = $1 AND NOT revoked
+	`
+
+	queries.RevokeAccessToken = `
+		INSERT INTO
+			revoked_tokens
+		(jti, expires_at)
+		values
+		($1, $2)
+		ON CONFLICT (jti) DO NOTHING
+	`
+
+	queries.AccessTokenRevoked = `
+		SELECT
+			EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)
+	`
+
+	queries.PurgeExpiredTokens = []string{
+		`DELETE FROM revoked_tokens WHERE expires_at < $1`,
+		`DELETE FROM refresh_tokens WHERE expires_at < $1`,
+		`DELETE FROM user_tokens WHERE expires_at < $1`,
+	}
+
 	return queries
 }
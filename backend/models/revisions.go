@@ -0,0 +1,191 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// MovieRevision type is a snapshot of movie with its genres, taken when
+// movie is created or updated. Revision is the movie version.
+type MovieRevision struct {
+	MovieID  int   `json:"movie_id"`
+	Revision int   `json:"revision"`
+	Movie    Movie `json:"movie"`
+	GenreIDs []int `json:"genre_ids"`
+	// User who made the revision, nil if unknown
+	ActorID   *int      `json:"actor_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DiffRevisions returns movie fields which differ between revisions
+func DiffRevisions(from, to *MovieRevision) map[string]AuditChange {
+	changes := diffSnapshots(from.state(), to.state())
+
+	// Version is the revision itself and revisions are never deleted
+	delete(changes, "version")
+	delete(changes, "deleted_at")
+
+	return changes
+}
+
+// state returns movie state of revision, the same as audited one
+func (rev *MovieRevision) state() map[string]interface{} {
+	ids := make([]int64, 0, len(rev.GenreIDs))
+	for _, id := range rev.GenreIDs {
+		ids = append(ids, int64(id))
+	}
+
+	return snapshotMovie(rev.Movie, ids)
+}
+
+// saveRevision saves revision of movie's current state read by tx. Author
+// is the actor, if any.
+func (m *DBModel) saveRevision(ctx context.Context, tx *sql.Tx, id int, actor *Actor) error {
+	var movie Movie
+	err := tx.QueryRowContext(ctx, m.Queries.GetMovie, id).Scan(
+		&movie.ID,
+		&movie.Title,
+		&movie.Description,
+		&movie.Year,
+		&movie.ReleaseDate,
+		&movie.Runtime,
+		&movie.Rating,
+		&movie.MPAARating,
+		&movie.CreatedAt,
+		&movie.UpdatedAt,
+		&movie.Version,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, m.Queries.GetGenresByMovie, id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	movie.MovieGenre = make(map[int]string)
+	genreIDs := []int64{}
+	for rows.Next() {
+		var mg MovieGenre
+		if err := rows.Scan(
+			&mg.ID,
+			&mg.MovieID,
+			&mg.GenreID,
+			&mg.Genre.GenreName,
+		); err != nil {
+			return err
+		}
+
+		movie.MovieGenre[mg.ID] = mg.Genre.GenreName
+		genreIDs = append(genreIDs, int64(mg.GenreID))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(movie)
+	if err != nil {
+		return err
+	}
+
+	var actorID sql.NullInt64
+	if actor != nil {
+		actorID = sql.NullInt64{Int64: int64(actor.UserID), Valid: true}
+	}
+
+	_, err = tx.ExecContext(ctx, m.Queries.InsertMovieRevision,
+		id,
+		movie.Version,
+		data,
+		pq.Array(genreIDs),
+		actorID,
+		time.Now(),
+	)
+
+	return err
+}
+
+// MovieRevisions returns all revisions of movie, the latest first
+func (m *DBModel) MovieRevisions(movieID int) ([]*MovieRevision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, m.Queries.GetMovieRevisions, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*MovieRevision{}
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err()
+}
+
+// MovieRevision returns one revision of movie or ErrNoRecord
+func (m *DBModel) MovieRevision(movieID, revision int) (*MovieRevision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rev, err := scanRevision(m.DB.QueryRowContext(ctx, m.Queries.GetMovieRevision, movieID, revision))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return rev, nil
+}
+
+// scanRevision reads revision from row of revisions query
+func scanRevision(row interface{ Scan(...interface{}) error }) (*MovieRevision, error) {
+	var rev MovieRevision
+	var data []byte
+	var genreIDs []int64
+	var actorID sql.NullInt64
+
+	if err := row.Scan(
+		&rev.MovieID,
+		&rev.Revision,
+		&data,
+		pq.Array(&genreIDs),
+		&actorID,
+		&rev.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &rev.Movie); err != nil {
+		return nil, err
+	}
+
+	rev.GenreIDs = make([]int, 0, len(genreIDs))
+	for _, id := range genreIDs {
+		rev.GenreIDs = append(rev.GenreIDs, int(id))
+	}
+
+	if actorID.Valid {
+		id := int(actorID.Int64)
+		rev.ActorID = &id
+	}
+
+	return &rev, nil
+}
@@ -0,0 +1,40 @@
+package models
+
+// User roles, from the least to the most privileged
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+// Permissions checked by protected APIs
+const (
+	PermMoviesWrite = "movies:write"
+	PermGenresWrite = "genres:write"
+	PermUsersManage = "users:manage"
+	PermAuditRead   = "audit:read"
+)
+
+// rolePermissions maps every role to the list of its permissions
+var rolePermissions = map[string][]string{
+	RoleViewer: {},
+	RoleEditor: {PermMoviesWrite, PermGenresWrite},
+	RoleAdmin:  {PermMoviesWrite, PermGenresWrite, PermUsersManage, PermAuditRead},
+}
+
+// ValidRole reports whether role is known
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// HasPermission reports whether role grants permission
+func HasPermission(role, permission string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// searchTerms splits full-text query into lowercased words, all other
+// characters (including tsquery operators) are dropped
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// prefixTSQuery builds PostgreSQL tsquery matching all words of query as
+// prefixes, e.g. "star wa" becomes "star:* & wa:*"
+func prefixTSQuery(query string) string {
+	terms := searchTerms(query)
+	for i, term := range terms {
+		terms[i] = term + ":*"
+	}
+
+	return strings.Join(terms, " & ")
+}
+
+// Search returns up to limit movies, all query words of which are prefixes
+// of title or description words. Ranking and highlighting mimic DBModel:
+// title matches weigh more than description ones.
+func (m *MemoryModel) Search(query string, limit int) ([]*SearchResult, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []*SearchResult{}, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	results := []*SearchResult{}
+	for id, movie := range m.movies {
+		title, titleHits := highlight(movie.Title, terms)
+		snippet, descHits := highlight(movie.Description, terms)
+
+		matched := true
+		for _, term := range terms {
+			if titleHits[term] == 0 && descHits[term] == 0 {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		var rank float64
+		for _, term := range terms {
+			rank += float64(titleHits[term]) + 0.4*float64(descHits[term])
+		}
+
+		movie.MovieGenre = m.genresByMovie(id)
+		results = append(results, &SearchResult{
+			Movie:          movie,
+			Rank:           rank,
+			TitleHighlight: title,
+			Snippet:        snippet,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].Title < results[j].Title
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
+}
+
+// highlight wraps words of text starting with any of terms in <b> tags and
+// counts matches per term
+func highlight(text string, terms []string) (string, map[string]int) {
+	hits := make(map[string]int)
+
+	var b strings.Builder
+	var word []rune
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+
+		w := string(word)
+		matched := false
+		for _, term := range terms {
+			if strings.HasPrefix(strings.ToLower(w), term) {
+				hits[term]++
+				matched = true
+			}
+		}
+
+		if matched {
+			b.WriteString("<b>" + w + "</b>")
+		} else {
+			b.WriteString(w)
+		}
+		word = word[:0]
+	}
+
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		b.WriteRune(r)
+	}
+	flush()
+
+	return b.String(), hits
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// UpsertGenre returns ID of genre with the same name, creating it if
+// there is no such one.
+func (m *DBModel) UpsertGenre(genre Genre) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+	err := m.DB.QueryRowContext(ctx, m.Queries.GetGenreByName, genre.GenreName).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	return m.InsertGenre(genre)
+}
+
+// UpsertMovie updates movie with the same title and year and links it with
+// genres of genreIDs, or creates a new one if there is no such movie.
+// Genre links are only added, movie is left untouched if nothing changes.
+// Movie is updated as by UpdateMovie, so ErrEditConflict is returned if it
+// is changed meanwhile. Returns movie ID.
+func (m *DBModel) UpsertMovie(movie Movie, genreIDs []int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var stored Movie
+	var linked []int64
+	err := m.DB.QueryRowContext(ctx, m.Queries.GetMovieByKey, movie.Title, movie.Year).Scan(
+		&stored.ID,
+		&stored.Title,
+		&stored.Description,
+		&stored.Year,
+		&stored.ReleaseDate,
+		&stored.Runtime,
+		&stored.Rating,
+		&stored.MPAARating,
+		&stored.Version,
+		pq.Array(&linked),
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		movie.CreatedAt = time.Now()
+		movie.UpdatedAt = movie.CreatedAt
+		return m.InsertMovie(movie, genreIDs)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	ids, added := seedGenreIDs(linked, genreIDs)
+	if !added && sameMovieFields(&stored, &movie) {
+		return stored.ID, nil
+	}
+
+	movie.ID = stored.ID
+	movie.Version = stored.Version
+	movie.UpdatedAt = time.Now()
+	if err := m.UpdateMovie(movie, ids); err != nil {
+		return 0, err
+	}
+
+	return movie.ID, nil
+}
+
+// seedGenreIDs returns IDs of genres of linked ones, which movie is linked
+// with, together with genres of genreIDs, and whether any of the latter is
+// missing in linked.
+func seedGenreIDs(linked []int64, genreIDs []int) ([]int, bool) {
+	seen := make(map[int]bool)
+	ids := make([]int, 0, len(linked)+len(genreIDs))
+	for _, id := range linked {
+		seen[int(id)] = true
+		ids = append(ids, int(id))
+	}
+
+	added := false
+	for _, id := range genreIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+			added = true
+		}
+	}
+
+	return ids, added
+}
+
+// sameMovieFields reports whether movies have the same values of fields
+// loaded from fixtures.
+func sameMovieFields(a, b *Movie) bool {
+	return a.Title == b.Title &&
+		a.Description == b.Description &&
+		a.Year == b.Year &&
+		a.ReleaseDate.Equal(b.ReleaseDate) &&
+		a.Runtime == b.Runtime &&
+		a.Rating == b.Rating &&
+		a.MPAARating == b.MPAARating
+}
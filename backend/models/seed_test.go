@@ -0,0 +1,195 @@
+package models_test
+
+import (
+	"backend/fixtures"
+	"backend/models"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// forEachStore function runs test against in-memory store and PostgreSQL
+// one of TEST_DSN env var, the latter is skipped if it's not set. The
+// database must be a disposable one with migrations applied.
+func forEachStore(t *testing.T, test func(t *testing.T, store models.Store)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, models.NewMemoryModels().DB.WithActor(models.SystemActor("test")))
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv("TEST_DSN")
+		if dsn == "" {
+			t.Skip("TEST_DSN is not set, PostgreSQL tests are skipped")
+		}
+
+		db, err := sql.Open("postgres", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		test(t, models.NewModels(db).DB.WithActor(models.SystemActor("test")))
+	})
+}
+
+// seedMovies function seeds fixtures into store and returns all stored
+// movies by their titles and years.
+func seedMovies(t *testing.T, store models.Store, f *fixtures.Fixtures) map[string]*models.Movie {
+	t.Helper()
+
+	if _, err := f.Seed(store); err != nil {
+		t.Fatal(err)
+	}
+
+	movies, _, err := store.List(models.MovieFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byKey := make(map[string]*models.Movie)
+	for _, movie := range movies {
+		byKey[movieKey(movie.Title, movie.Year)] = movie
+	}
+
+	return byKey
+}
+
+// movieKey function returns natural key of movie.
+func movieKey(title string, year int) string {
+	return fmt.Sprintf("%s (%d)", title, year)
+}
+
+// revisions function returns number of movie revisions and the latest one.
+func revisions(t *testing.T, store models.Store, movieID int) (int, *models.MovieRevision) {
+	t.Helper()
+
+	revisions, err := store.MovieRevisions(movieID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) == 0 {
+		t.Fatalf("no revisions of movie %d", movieID)
+	}
+
+	return len(revisions), revisions[0]
+}
+
+// hasGenres function reports whether movie is linked with all genres of
+// names.
+func hasGenres(movie *models.Movie, names []string) bool {
+	linked := make(map[string]bool)
+	for _, name := range movie.MovieGenre {
+		linked[name] = true
+	}
+
+	for _, name := range names {
+		if !linked[name] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestSeedIdempotent(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store models.Store) {
+		sample, err := fixtures.Sample()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		first := seedMovies(t, store, sample)
+		counts := make(map[int]int)
+		for _, movie := range first {
+			counts[movie.ID], _ = revisions(t, store, movie.ID)
+		}
+
+		second := seedMovies(t, store, sample)
+
+		for _, fm := range sample.Movies {
+			key := movieKey(fm.Title, fm.Year)
+			before, after := first[key], second[key]
+			if before == nil || after == nil {
+				t.Fatalf("movie %s isn't seeded", key)
+			}
+
+			if after.ID != before.ID || after.Version != before.Version {
+				t.Errorf("movie %s is %d version %d after rerun, expected %d version %d",
+					key, after.ID, after.Version, before.ID, before.Version)
+			}
+
+			if !hasGenres(after, fm.Genres) {
+				t.Errorf("movie %s genres %v, expected %v", key, after.MovieGenre, fm.Genres)
+			}
+
+			count, latest := revisions(t, store, after.ID)
+			if count != counts[after.ID] {
+				t.Errorf("movie %s has %d revisions after rerun, expected %d", key, count, counts[after.ID])
+			}
+			if latest.Revision != after.Version || len(latest.GenreIDs) != len(after.MovieGenre) {
+				t.Errorf("the latest revision %+v of movie %s doesn't match its version %d with %d genres",
+					latest, key, after.Version, len(after.MovieGenre))
+			}
+		}
+	})
+}
+
+func TestSeedChanges(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store models.Store) {
+		sample, err := fixtures.Sample()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fm := sample.Movies[0]
+		key := movieKey(fm.Title, fm.Year)
+
+		changed := *sample
+		changed.Movies = append([]fixtures.Movie{}, sample.Movies...)
+		changed.Movies[0].Rating = 1
+
+		linked := changed
+		linked.Movies = append([]fixtures.Movie{}, changed.Movies...)
+		// Genre is new even if database has genres of previous runs
+		genre := fmt.Sprintf("Documentary %d", time.Now().UnixNano())
+		linked.Movies[0].Genres = append([]string{genre}, fm.Genres...)
+
+		movie := seedMovies(t, store, sample)[key]
+		count, _ := revisions(t, store, movie.ID)
+
+		steps := []struct {
+			name     string
+			fixtures *fixtures.Fixtures
+			// Expected increase of version since the first seed
+			versions int
+			rating   int
+			genres   []string
+		}{
+			{"changed field", &changed, 1, 1, fm.Genres},
+			{"the same fields", &changed, 1, 1, fm.Genres},
+			{"added genre", &linked, 2, 1, linked.Movies[0].Genres},
+			{"genre links are kept", sample, 3, fm.Rating, linked.Movies[0].Genres},
+		}
+
+		for _, step := range steps {
+			got := seedMovies(t, store, step.fixtures)[key]
+
+			if got.ID != movie.ID || got.Version != movie.Version+step.versions {
+				t.Fatalf("%s: movie %d version %d, expected %d version %d",
+					step.name, got.ID, got.Version, movie.ID, movie.Version+step.versions)
+			}
+			if got.Rating != step.rating || !hasGenres(got, step.genres) {
+				t.Fatalf("%s: movie rating %d with genres %v, expected %d with %v",
+					step.name, got.Rating, got.MovieGenre, step.rating, step.genres)
+			}
+
+			n, latest := revisions(t, store, got.ID)
+			if n != count+step.versions || latest.Revision != got.Version || latest.Movie.Rating != got.Rating {
+				t.Fatalf("%s: %d revisions, the latest %+v, expected %d revisions, the latest of version %d",
+					step.name, n, latest, count+step.versions, got.Version)
+			}
+		}
+	})
+}
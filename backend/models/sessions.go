@@ -0,0 +1,121 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// InsertRefreshToken stores hash of a new refresh token
+func (m *DBModel) InsertRefreshToken(token RefreshToken) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, m.Queries.InsertRefreshToken,
+		token.Hash,
+		token.UserID,
+		token.Family,
+		token.Expiry,
+		time.Now(),
+	)
+
+	return err
+}
+
+// UseRefreshToken marks refresh token as used and returns it. Returns
+// ErrNoRecord if token is unknown. If token was already used or revoked,
+// whole token family is revoked and ErrTokenReused is returned. Expiry is
+// left to be checked by caller.
+func (m *DBModel) UseRefreshToken(plaintext string) (*RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	token := RefreshToken{Hash: HashToken(plaintext)}
+
+	err := m.DB.QueryRowContext(ctx, m.Queries.UseRefreshToken, token.Hash, time.Now()).Scan(
+		&token.UserID,
+		&token.Family,
+		&token.Expiry,
+	)
+	if err == nil {
+		return &token, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	// Token is either unknown or already used: the latter means it was
+	// stolen, so nobody may use the family anymore
+	err = m.DB.QueryRowContext(ctx, m.Queries.GetRefreshFamily, token.Hash).Scan(&token.Family)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	if _, err := m.DB.ExecContext(ctx, m.Queries.RevokeRefreshFamily, token.Family); err != nil {
+		return nil, err
+	}
+
+	return nil, ErrTokenReused
+}
+
+// RevokeRefreshFamily revokes all refresh tokens of family
+func (m *DBModel) RevokeRefreshFamily(family string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, m.Queries.RevokeRefreshFamily, family)
+
+	return err
+}
+
+// RevokeUserRefreshFamilies revokes all refresh tokens of user, so every
+// signed in session of user ends once its access token expires
+func (m *DBModel) RevokeUserRefreshFamilies(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, m.Queries.RevokeUserRefresh, userID)
+
+	return err
+}
+
+// RevokeAccessToken adds access token ID into revocation list. Expiry is
+// kept to purge the entry once token is expired anyway.
+func (m *DBModel) RevokeAccessToken(jti string, expiry time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, m.Queries.RevokeAccessToken, jti, expiry)
+
+	return err
+}
+
+// AccessTokenRevoked reports whether access token ID is in revocation list
+func (m *DBModel) AccessTokenRevoked(jti string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var revoked bool
+	err := m.DB.QueryRowContext(ctx, m.Queries.AccessTokenRevoked, jti).Scan(&revoked)
+
+	return revoked, err
+}
+
+// PurgeExpiredTokens deletes expired refresh, user and revoked access tokens
+func (m *DBModel) PurgeExpiredTokens() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	for _, stmt := range m.Queries.PurgeExpiredTokens {
+		if _, err := m.DB.ExecContext(ctx, stmt, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"time"
+)
+
+// Scopes of user tokens
+const (
+	ScopeVerification  = "verification"
+	ScopePasswordReset = "password-reset"
+)
+
+// UserToken type describes single-use expiring token sent to user by email.
+// Only SHA-256 hash of token is stored, plaintext is known to user only.
+type UserToken struct {
+	Hash   []byte
+	UserID int
+	Scope  string
+	Expiry time.Time
+}
+
+// NewUserToken generates a new random token of scope for user, valid for
+// ttl. Returns token plaintext to be sent to user and token to be stored.
+func NewUserToken(userID int, ttl time.Duration, scope string) (string, UserToken, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", UserToken{}, err
+	}
+
+	plaintext := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)
+
+	token := UserToken{
+		Hash:   HashToken(plaintext),
+		UserID: userID,
+		Scope:  scope,
+		Expiry: time.Now().Add(ttl),
+	}
+
+	return plaintext, token, nil
+}
+
+// HashToken returns SHA-256 hash of token plaintext
+func HashToken(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
+
+// RefreshToken type describes long-lived token exchanged for a new access
+// token. Every refresh token is single-use: it's rotated on each exchange
+// within the same family, started by signin. Only hash is stored.
+type RefreshToken struct {
+	Hash   []byte
+	UserID int
+	Family string
+	Expiry time.Time
+}
+
+// NewRefreshToken generates a new refresh token of family for user, valid
+// for ttl. New family is started if family is empty. Returns token
+// plaintext to be sent to user and token to be stored.
+func NewRefreshToken(userID int, family string, ttl time.Duration) (string, RefreshToken, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", RefreshToken{}, err
+	}
+
+	if family == "" {
+		var err error
+		if family, err = RandomID(); err != nil {
+			return "", RefreshToken{}, err
+		}
+	}
+
+	plaintext := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)
+
+	token := RefreshToken{
+		Hash:   HashToken(plaintext),
+		UserID: userID,
+		Family: family,
+		Expiry: time.Now().Add(ttl),
+	}
+
+	return plaintext, token, nil
+}
+
+// RandomID returns random 128-bit identifier in hex, e.g. for JWT ID
+func RandomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
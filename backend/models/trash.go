@@ -0,0 +1,124 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DeletedMovies returns movies in trash with their genres, the most recently
+// deleted first
+func (m *DBModel) DeletedMovies() ([]*Movie, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, m.Queries.GetDeletedMovies)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+	for rows.Next() {
+		var movie Movie
+		if err := rows.Scan(
+			&movie.ID,
+			&movie.Title,
+			&movie.Description,
+			&movie.Year,
+			&movie.ReleaseDate,
+			&movie.Runtime,
+			&movie.Rating,
+			&movie.MPAARating,
+			&movie.CreatedAt,
+			&movie.UpdatedAt,
+			&movie.Version,
+			&movie.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := m.attachGenres(ctx, movies); err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
+
+// RestoreMovie takes movie out of trash together with its genre links,
+// returns ErrNoRecord if there is no such movie in trash
+func (m *DBModel) RestoreMovie(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.changeMovie(ctx, AuditRestore, id, m.Queries.RestoreMovie, id, time.Now())
+}
+
+// PurgeDeletedMovies permanently deletes movies moved to trash before the
+// given time, returns number of deleted movies
+func (m *DBModel) PurgeDeletedMovies(before time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, m.Queries.GetPurgedMovies, before)
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	// States are read before genre links are deleted by cascade
+	states := make([]map[string]interface{}, len(ids))
+	for i, id := range ids {
+		if states[i], err = m.movieState(ctx, tx, id); err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, m.Queries.PurgeDeletedMovies, pq.Array(uniqueIDs(ids))); err != nil {
+		return 0, err
+	}
+
+	for i, id := range ids {
+		if err := m.audit(ctx, tx, AuditPurge, EntityMovie, id, states[i], nil); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(ids), nil
+}
@@ -0,0 +1,219 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// normalizeEmail returns email in the form it's stored and looked up by
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// InsertUser creates a new user and returns its ID. Returns
+// ErrDuplicateEmail if email is already taken.
+func (m *DBModel) InsertUser(user User) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	user.UpdatedAt = now
+
+	if user.Role == "" {
+		user.Role = RoleViewer
+	}
+
+	var id int
+	err := m.DB.QueryRowContext(ctx, m.Queries.InsertUser,
+		normalizeEmail(user.Email),
+		user.Password,
+		user.Disabled,
+		user.Verified,
+		user.Role,
+		user.CreatedAt,
+		user.UpdatedAt,
+	).Scan(&id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return 0, ErrDuplicateEmail
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetUser returns one user or ErrNoRecord
+func (m *DBModel) GetUser(id int) (*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var user User
+	err := m.DB.QueryRowContext(ctx, m.Queries.GetUser, id).Scan(
+		&user.ID,
+		&user.Email,
+		&user.Password,
+		&user.Disabled,
+		&user.Verified,
+		&user.Role,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// GetUserByEmail returns one user or ErrNoRecord
+func (m *DBModel) GetUserByEmail(email string) (*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var user User
+	err := m.DB.QueryRowContext(ctx, m.Queries.GetUserByEmail, normalizeEmail(email)).Scan(
+		&user.ID,
+		&user.Email,
+		&user.Password,
+		&user.Disabled,
+		&user.Verified,
+		&user.Role,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// UpdateUserPassword replaces bcrypt hash of user's password
+func (m *DBModel) UpdateUserPassword(id int, passwordHash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, m.Queries.UpdateUserPassword, passwordHash, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+// DisableUser marks user as disabled, such user is not able to sign in
+func (m *DBModel) DisableUser(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, m.Queries.DisableUser, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+// expectAffected returns ErrNoRecord if statement affected no rows
+func expectAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// VerifyUser marks user's email as verified
+func (m *DBModel) VerifyUser(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, m.Queries.VerifyUser, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+// SetUserRole changes role of user
+func (m *DBModel) SetUserRole(id int, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, m.Queries.SetUserRole, role, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+// InsertUserToken stores hash of a new user token
+func (m *DBModel) InsertUserToken(token UserToken) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, m.Queries.InsertUserToken,
+		token.Hash,
+		token.UserID,
+		token.Scope,
+		token.Expiry,
+		time.Now(),
+	)
+
+	return err
+}
+
+// UseUserToken consumes token of scope and returns ID of its user. Returns
+// ErrNoRecord if token is unknown, expired or was already used.
+func (m *DBModel) UseUserToken(plaintext, scope string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var userID int
+	err := m.DB.QueryRowContext(ctx, m.Queries.UseUserToken,
+		HashToken(plaintext),
+		scope,
+		time.Now(),
+	).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// DeleteUserTokens deletes all user tokens of scope
+func (m *DBModel) DeleteUserTokens(userID int, scope string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, m.Queries.DeleteUserTokens, userID, scope)
+
+	return err
+}
@@ -11,7 +11,7 @@ import TextArea from "./form-components/TextArea";
 import "react-confirm-alert/src/react-confirm-alert.css";
 import "./EditMovie.css";
 
-const MPAA_RATINGS = ["G", "PG", "PG-13", "R", "NC17"];
+const MPAA_RATINGS = ["G", "PG", "PG-13", "R", "NC-17"];
 
 export default function EditMovieFunc(props) {
   const [movie, setMovie] = useState({
@@ -23,9 +23,12 @@ export default function EditMovieFunc(props) {
     rating: "",
     description: "",
   });
+  // ETag of loaded movie version, sent back with changes
+  const [etag, setEtag] = useState(null);
   const [isLoaded, setisLoaded] = useState(false);
   const [error, setError] = useState(null);
-  const [errors, setErrors] = useState([]);
+  // Validation error messages by movie fields
+  const [errors, setErrors] = useState({});
   const [alert, setAlert] = useState({
     type: "d-none",
     message: "",
@@ -47,6 +50,7 @@ export default function EditMovieFunc(props) {
             setError("Invalid response code: " + response.status);
           } else {
             setError(null);
+            setEtag(response.headers.get("ETag"));
           }
 
           return response.json();
@@ -128,15 +132,15 @@ export default function EditMovieFunc(props) {
   const handleSubmit = (evt) => {
     evt.preventDefault();
 
-    // Client-side validation
-    const errors = [];
-    if (movie.title === "") {
-      errors.push("title");
+    // Client-side validation, the rest is validated by API
+    const errors = {};
+    if (movie.title.trim() === "") {
+      errors.title = "Please enter a Title";
     }
 
     setErrors(errors);
 
-    if (errors.length > 0) {
+    if (Object.keys(errors).length > 0) {
       return false;
     }
 
@@ -145,6 +149,9 @@ export default function EditMovieFunc(props) {
     const headers = new Headers();
     headers.append("Content-Type", "application/json");
     headers.append("Authorization", `Bearer ${props.jwt}`);
+    if (etag) {
+      headers.append("If-Match", etag);
+    }
 
     const requestOptions = {
       method: "POST",
@@ -153,9 +160,19 @@ export default function EditMovieFunc(props) {
     };
 
     fetch(`${process.env.REACT_APP_API_URL}/v1/admin/editmovie`, requestOptions)
-      .then((response) => response.json())
+      .then((response) => {
+        // Movie was changed by someone else: saving again overwrites the
+        // current version
+        if (response.status === 412) {
+          setEtag(response.headers.get("ETag"));
+        }
+
+        return response.json();
+      })
       .then((data) => {
         if (data.error) {
+          // Invalid fields are shown next to their inputs
+          setErrors(data.error.fields || {});
           setAlert({
             type: "alert-danger",
             message: data.error.message
@@ -167,7 +184,14 @@ export default function EditMovieFunc(props) {
   }
 
   // hasError function checks if the component has form validation errors
-  const hasError = (key) => errors.indexOf(key) !== -1;
+  const hasError = (key) => key in errors;
+
+  // fieldProps function returns error props of form input by its name
+  const fieldProps = (key) => ({
+    className: hasError(key) ? "is-invalid" : "",
+    errorDiv: hasError(key) ? "text-danger" : "d-none",
+    errorMsg: errors[key],
+  });
 
   if (error) return <div>Error: {error.message}</div>;
   if (!isLoaded) return <Loading />;
@@ -190,14 +214,12 @@ export default function EditMovieFunc(props) {
         />
 
         <Input
-          className={hasError("title") ? "is-invalid" : ""}
           name={"title"}
           title={"Title"}
           type={"text"}
           value={movie.title}
           handleChange={handleChange}
-          errorDiv={hasError("title") ? "text-danger" : "d-none"}
-          errorMsg={"Please enter a Title"}
+          {...fieldProps("title")}
         />
 
         <Input
@@ -206,6 +228,7 @@ export default function EditMovieFunc(props) {
           type={"date"}
           value={movie.release_date}
           handleChange={handleChange}
+          {...fieldProps("release_date")}
         />
 
         <Input
@@ -214,6 +237,7 @@ export default function EditMovieFunc(props) {
           type={"text"}
           value={movie.runtime}
           handleChange={handleChange}
+          {...fieldProps("runtime")}
         />
 
         <Select
@@ -223,6 +247,7 @@ export default function EditMovieFunc(props) {
           handleChange={handleChange}
           options={MPAA_RATINGS}
           placeholder={"Choose ..."}
+          {...fieldProps("mpaa_rating")}
         />
 
 
@@ -232,6 +257,7 @@ export default function EditMovieFunc(props) {
           type={"text"}
           value={movie.rating}
           handleChange={handleChange}
+          {...fieldProps("rating")}
         />
 
         <TextArea
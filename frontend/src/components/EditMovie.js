@@ -10,7 +10,7 @@ import TextArea from "./form-components/TextArea";
 import "react-confirm-alert/src/react-confirm-alert.css";
 import "./EditMovie.css";
 
-const MPAA_RATINGS = ["G", "PG", "PG-13", "R", "NC17"];
+const MPAA_RATINGS = ["G", "PG", "PG-13", "R", "NC-17"];
 
 export default class EditMovie extends Component {
   constructor(props) {
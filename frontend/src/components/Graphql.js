@@ -20,7 +20,7 @@ export default class Graphql extends Component {
   }
 
   getAllMovies() {
-    const payload = `
+    const query = `
     {
       list {
         id
@@ -36,7 +36,7 @@ export default class Graphql extends Component {
 
     const requestOptions = {
       method: "POST",
-      body: payload,
+      body: JSON.stringify({ query }),
       headers,
     };
 
@@ -76,9 +76,9 @@ export default class Graphql extends Component {
   }
 
   performSearch() {
-    const payload = `
-    {
-      search(titleContains: "${this.state.searchTerm}") {
+    const query = `
+    query SearchMovies($titleContains: String) {
+      search(titleContains: $titleContains) {
         id
         title
         runtime
@@ -92,7 +92,10 @@ export default class Graphql extends Component {
 
     const requestOptions = {
       method: "POST",
-      body: payload,
+      body: JSON.stringify({
+        query,
+        variables: { titleContains: this.state.searchTerm },
+      }),
       headers,
     };
 
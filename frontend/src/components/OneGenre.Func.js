@@ -10,7 +10,7 @@ export default function OneGenreFunc(props) {
   const [genreName, setGenreName] = useState("");
 
   useEffect(() => {
-    fetch(`${process.env.REACT_APP_API_URL}/v1/movies/` + props.match.params.id)
+    fetch(`${process.env.REACT_APP_API_URL}/v1/genres/` + props.match.params.id + "/movies")
       .then((response) => {
         if (response.status !== 200) {
           setError("Invalid response code: " + response.status);
@@ -10,7 +10,7 @@ export default class OneGenre extends Component {
   };
 
   componentDidMount() {
-    fetch(`${process.env.REACT_APP_API_URL}/v1/movies/` + this.props.match.params.id)
+    fetch(`${process.env.REACT_APP_API_URL}/v1/genres/` + this.props.match.params.id + "/movies")
       .then((response) => {
         if (response.status !== 200) {
           const err = Error;
@@ -8,9 +8,9 @@ export default class OneMovieGraphql extends Component {
   };
 
   componentDidMount() {
-    const payload = `
-    {
-      movie(id: ${this.props.match.params.id}) {
+    const query = `
+    query Movie($id: Int!) {
+      movie(id: $id) {
         id
         title
         runtime
@@ -27,7 +27,10 @@ export default class OneMovieGraphql extends Component {
 
     const requestOptions = {
       method: "POST",
-      body: payload,
+      body: JSON.stringify({
+        query,
+        variables: { id: parseInt(this.props.match.params.id, 10) },
+      }),
       headers,
     };
 
@@ -24,7 +24,7 @@ export default function Select(props) {
     <div className="mb-3">
       <label htmlFor={props.name} className="form-label">{props.title}</label>
       <select
-        className="form-select"
+        className={`form-select ${props.className}`}
         id={props.name}
         name={props.name}
         value={props.value}
@@ -41,6 +41,7 @@ export default function Select(props) {
           </option>
         ))}
       </select>
+      <div className={props.errorDiv}>{props.errorMsg}</div>
     </div>
   );
 }